@@ -28,13 +28,41 @@ def get_address_book(host_name, token, ca_bundle):
 
 
 def save_address_book(data, host_name, token, ca_bundle):
+    # Absences may name other recipients as substitutes. These have to exist before the absences
+    # are saved. Therefore all recipients are saved without absences first.
+    for absences_pass in [False, True]:
+        for i in data:
+            if absences_pass and not i.get("absences", []):
+                continue
+
+            url = f'{host_name}{CONF_API_PREFIX}/api/addressbook/{i["id"]}'
+            body = {
+                "addr_type": i["addr_type"],
+                "address": i["address"],
+                "display_name": i["display_name"],
+                "is_default": i["is_default"],
+                "fallbacks": i.get("fallbacks", []),
+                "absences": i.get("absences", []) if absences_pass else [],
+                "options": i.get("options", {})
+            }
+            
+            response = requests.put(url, data=json.dumps(body).encode('utf-8'), verify=ca_bundle, headers=get_std_headers(token))
+            response.raise_for_status()
+
+
+def get_groups(host_name, token, ca_bundle):
+    url = f'{host_name}{CONF_API_PREFIX}/api/addressbook/groups'
+    response = requests.get(url, verify=ca_bundle, headers=get_std_headers(token))
+    response.raise_for_status()
+    return response.json()["groups"]
+
+
+def save_groups(data, host_name, token, ca_bundle):
     for i in data:
-        url = f'{host_name}{CONF_API_PREFIX}/api/addressbook/{i["id"]}'
+        url = f'{host_name}{CONF_API_PREFIX}/api/addressbook/groups/{i["id"]}'
         body = {
-            "addr_type": i["addr_type"],
-            "address": i["address"],
-            "display_name": i["display_name"],
-            "is_default": i["is_default"] 
+            "name": i["name"],
+            "members": i["members"]
         }
         
         response = requests.put(url, data=json.dumps(body).encode('utf-8'), verify=ca_bundle, headers=get_std_headers(token))
@@ -50,7 +78,9 @@ def save_reminders(data, host_name, token, ca_bundle):
             "param": i["param"],
             "recipients": i["recipients"],
             "spec": i["spec"],
-            "warning_at": i["warning_at"]
+            "warning_at": i["warning_at"],
+            "priority": i.get("priority", 0),
+            "options": i.get("options", {})
         }
         
         response = requests.put(url, data=json.dumps(body).encode('utf-8'), verify=ca_bundle, headers=get_std_headers(token))
@@ -59,8 +89,9 @@ def save_reminders(data, host_name, token, ca_bundle):
 
 def do_backup(host_name, ca_bundle, out_file, token):
     addr_book = get_address_book(host_name, token, ca_bundle)
+    groups = get_groups(host_name, token, ca_bundle)
     reminders = get_reminders(host_name, token, ca_bundle)
-    backup = {"address_book": addr_book, "reminders":reminders}
+    backup = {"address_book": addr_book, "groups": groups, "reminders":reminders}
     bkp = json.dumps(backup).encode('utf-8')
     with open(out_file, "wb") as f:
         f.write(bkp)
@@ -71,6 +102,7 @@ def do_restore(in_file, host_name, token, ca_bundle=None):
         data = json.load(f)
     
     save_address_book(data["address_book"]["recipients"], host_name, token, ca_bundle)
+    save_groups(data.get("groups", []), host_name, token, ca_bundle)
     save_reminders(data["reminders"], host_name, token, ca_bundle)
 
 
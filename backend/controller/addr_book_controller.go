@@ -2,12 +2,15 @@ package controller
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"notifier/logic"
 	"notifier/repo"
+	"notifier/sms"
 	"notifier/tools"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -15,10 +18,24 @@ import (
 type RecipientResponse GetResponseGeneric[*repo.Recipient]
 
 type RecipientData struct {
-	DisplayName string `json:"display_name"`
-	Address     string `json:"address"`
-	AddrType    string `json:"addr_type"`
-	IsDefault   bool   `json:"is_default"`
+	DisplayName string                  `json:"display_name"`
+	Address     string                  `json:"address"`
+	AddrType    string                  `json:"addr_type"`
+	IsDefault   bool                    `json:"is_default"`
+	Fallbacks   []repo.RecipientChannel `json:"fallbacks"`
+	Absences    []repo.Absence          `json:"absences"`
+	Options     map[string]string       `json:"options"`
+}
+
+type GroupResponse GetResponseGeneric[*repo.RecipientGroup]
+
+type GroupData struct {
+	Name    string        `json:"name"`
+	Members []*tools.UUID `json:"members"`
+}
+
+type AllGroupsResponse struct {
+	Groups []*repo.RecipientGroup `json:"groups"`
 }
 
 type AllRecipientsResponse struct {
@@ -60,6 +77,11 @@ func (a *AddressBookController) AddHandlersWithAuth(authWrapper tools.AuthWrappe
 	http.HandleFunc("DELETE /notifier/api/addressbook/{uuid}", authWrapper(a.HandleDelete))
 	http.HandleFunc("GET /notifier/api/addressbook/{uuid}", authWrapper(a.HandleGet))
 	http.HandleFunc("PUT /notifier/api/addressbook/{uuid}", authWrapper(a.HandleUpsert))
+	http.HandleFunc("GET /notifier/api/addressbook/groups", authWrapper(a.HandleListGroups))
+	http.HandleFunc("POST /notifier/api/addressbook/groups", authWrapper(a.HandleCreateGroup))
+	http.HandleFunc("DELETE /notifier/api/addressbook/groups/{uuid}", authWrapper(a.HandleDeleteGroup))
+	http.HandleFunc("GET /notifier/api/addressbook/groups/{uuid}", authWrapper(a.HandleGetGroup))
+	http.HandleFunc("PUT /notifier/api/addressbook/groups/{uuid}", authWrapper(a.HandleUpsertGroup))
 }
 
 // @Summary      Delete an address book entry
@@ -203,7 +225,7 @@ func (a *AddressBookController) HandleGet(w http.ResponseWriter, r *http.Request
 }
 
 // @Summary      Modify or create an address book entry
-// @Description  Create a new or modify an existing an address book entry with the id specified in the path.
+// @Description  Create a new or modify an existing an address book entry with the id specified in the path. If fallbacks or absences are omitted the existing values are kept. The policy of an absence is either suppress, defer or redirect. A redirection requires a substitute recipient.
 // @Tags	     AddressBook
 // @Accept       json
 // @Param        uuid   path  string  true  "UUID of address book entry"
@@ -226,6 +248,21 @@ func (a *AddressBookController) HandleUpsert(w http.ResponseWriter, r *http.Requ
 	a.HandleUpsertRaw(w, r, uuid)
 }
 
+func isAbsenceValid(absence *repo.Absence, recipient *tools.UUID) bool {
+	if !absence.Start.Before(absence.End) {
+		return false
+	}
+
+	switch absence.Policy {
+	case repo.AbsenceSuppress, repo.AbsenceDefer:
+		return absence.Substitute == nil
+	case repo.AbsenceRedirect:
+		return (absence.Substitute != nil) && !absence.Substitute.IsEqual(recipient)
+	default:
+		return false
+	}
+}
+
 func (a *AddressBookController) HandleUpsertRaw(w http.ResponseWriter, r *http.Request, uuid *tools.UUID) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -248,15 +285,107 @@ func (a *AddressBookController) HandleUpsertRaw(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	for _, j := range m.Fallbacks {
+		if (j.AddrType == "") || (j.Address == "") {
+			a.log.Printf("Incorrect fallback channel in body '%s'", string(body))
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		if !slices.Contains(a.addressTypes, j.AddrType) {
+			a.log.Printf("Unknown address type '%s' of fallback channel", j.AddrType)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+
+		err = sms.ValidateRecipientOptions(j.Options)
+		if err != nil {
+			a.log.Printf("Incorrect options of fallback channel: %v", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = sms.ValidateRecipientOptions(m.Options)
+	if err != nil {
+		a.log.Printf("Incorrect options: %v", err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	for _, j := range m.Absences {
+		if !isAbsenceValid(&j, uuid) {
+			a.log.Printf("Incorrect absence in body '%s'", string(body))
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+	}
+
 	repoWrite := repo.LockAndGetRepoRW(a.db, a.genWrite)
 	defer func() { a.db.Unlock() }()
 
+	existing, err := repoWrite.Get(uuid)
+	if err != nil {
+		a.log.Printf("error reading from db '%v'", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, j := range m.Absences {
+		if j.Substitute == nil {
+			continue
+		}
+
+		substitute, err := repoWrite.Get(j.Substitute)
+		if err != nil {
+			a.log.Printf("error reading from db '%v'", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if substitute == nil {
+			t := fmt.Sprintf("substitute '%s' is unknown", j.Substitute)
+			a.log.Println(t)
+			http.Error(w, t, http.StatusBadRequest)
+			return
+		}
+	}
+
+	group, err := repoWrite.GetGroup(uuid)
+	if err != nil {
+		a.log.Printf("error reading from db '%v'", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if group != nil {
+		a.log.Printf("Id '%s' is already used by a recipient group", uuid)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Clients which do not know about fallback channels must not remove them
+	if (m.Fallbacks == nil) && (existing != nil) {
+		m.Fallbacks = existing.Fallbacks
+	}
+
+	if (m.Absences == nil) && (existing != nil) {
+		m.Absences = existing.Absences
+	}
+
+	if (m.Options == nil) && (existing != nil) {
+		m.Options = existing.Options
+	}
+
 	recipient := repo.Recipient{
 		Id:          uuid,
 		DisplayName: m.DisplayName,
 		Address:     m.Address,
 		AddrType:    m.AddrType,
 		IsDefault:   m.IsDefault,
+		Fallbacks:   m.Fallbacks,
+		Absences:    m.Absences,
+		Options:     m.Options,
 	}
 
 	err = repoWrite.Upsert(&recipient)
@@ -297,3 +426,263 @@ func (a *AddressBookController) HandleUpsertRaw(w http.ResponseWriter, r *http.R
 func (a *AddressBookController) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	a.HandleUpsertRaw(w, r, tools.UUIDGen())
 }
+
+// @Summary      Get all recipient groups
+// @Description  Get all recipient groups as a JSON list sorted by name
+// @Tags	     AddressBook
+// @Success      200  {object} AllGroupsResponse
+// @Failure      500  {object} string
+// @Router       /notifier/api/addressbook/groups [get]
+// @Security     ApiKeyAuth
+func (a *AddressBookController) HandleListGroups(w http.ResponseWriter, r *http.Request) {
+	readRepo := repo.LockAndGetRepoR(a.db, a.genRead)
+	defer func() { a.db.RUnlock() }()
+
+	groups, err := readRepo.FilterGroups(func(*repo.RecipientGroup) bool { return true })
+	if err != nil {
+		a.log.Printf("error listing recipient groups: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return strings.Compare(groups[i].Name, groups[j].Name) == -1
+	})
+
+	resp := AllGroupsResponse{
+		Groups: groups,
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		a.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	a.log.Println("Created listing of all recipient groups")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
+
+// @Summary      Get a recipient group
+// @Description  Get the recipient group with the specified uuid
+// @Tags	     AddressBook
+// @Param        uuid   path  string  true  "UUID of recipient group"
+// @Success      200  {object} GroupResponse
+// @Failure      400  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/addressbook/groups/{uuid} [get]
+// @Security     ApiKeyAuth
+func (a *AddressBookController) HandleGetGroup(w http.ResponseWriter, r *http.Request) {
+	uuidRaw := r.PathValue("uuid")
+
+	uuid, ok := tools.NewUuidFromString(uuidRaw)
+	if !ok {
+		a.log.Printf("Unable to parse '%s' into uuid", uuidRaw)
+		http.Error(w, "UUID not wellformed", http.StatusBadRequest)
+		return
+	}
+
+	repoRead := repo.LockAndGetRepoR(a.db, a.genRead)
+	defer func() { a.db.RUnlock() }()
+
+	group, err := repoRead.GetGroup(uuid)
+	if err != nil {
+		a.log.Printf("error reading from database: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	response := GroupResponse{
+		Found: group != nil,
+		Data:  group,
+	}
+
+	data, err := json.Marshal(&response)
+	if err != nil {
+		a.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+
+	a.log.Printf("recipient group with id '%s' read from repo ", uuid)
+}
+
+// @Summary      Delete a recipient group
+// @Description  Delete the recipient group with the specified uuid. The group is also removed from all reminders. Reminders which are left without recipients are deleted
+// @Tags	     AddressBook
+// @Param        uuid   path  string  true  "UUID of recipient group"
+// @Success      200  {object} nil
+// @Failure      400  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/addressbook/groups/{uuid} [delete]
+// @Security     ApiKeyAuth
+func (a *AddressBookController) HandleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	uuidRaw := r.PathValue("uuid")
+
+	uuid, ok := tools.NewUuidFromString(uuidRaw)
+	if !ok {
+		a.log.Printf("Unable to parse '%s' into uuid", uuidRaw)
+		http.Error(w, "UUID not wellformed", http.StatusBadRequest)
+		return
+	}
+
+	nWrite, remWrite := a.dbRemNotif.Lock()
+	defer a.dbRemNotif.Unlock()
+
+	repoWrite := repo.LockAndGetRepoRW(a.db, a.genWrite)
+	defer func() { a.db.Unlock() }()
+
+	err := logic.DeleteGroup(nWrite, remWrite, repoWrite, uuid)
+	if err != nil {
+		a.log.Printf("error deleting from database: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	a.log.Printf("recipient group with id %s deleted", uuid)
+}
+
+// @Summary      Modify or create a recipient group
+// @Description  Create a new or modify an existing recipient group with the id specified in the path. All members have to be existing recipients. The notifications of all reminders which use the group are regenerated
+// @Tags	     AddressBook
+// @Accept       json
+// @Param        uuid   path  string  true  "UUID of recipient group"
+// @Param        group_data  body  GroupData true "Specification of recipient group to set"
+// @Success      200  {object} UuidResponse
+// @Failure      400  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/addressbook/groups/{uuid} [put]
+// @Security     ApiKeyAuth
+func (a *AddressBookController) HandleUpsertGroup(w http.ResponseWriter, r *http.Request) {
+	uuidRaw := r.PathValue("uuid")
+
+	uuid, ok := tools.NewUuidFromString(uuidRaw)
+	if !ok {
+		a.log.Printf("Unable to parse '%s' into uuid", uuidRaw)
+		http.Error(w, "UUID not wellformed", http.StatusBadRequest)
+		return
+	}
+
+	a.HandleUpsertGroupRaw(w, r, uuid)
+}
+
+// @Summary      Create a recipient group
+// @Description  Create a new recipient group. All members have to be existing recipients
+// @Tags	     AddressBook
+// @Accept       json
+// @Param        group_data  body  GroupData true "Specification of recipient group to set"
+// @Success      200  {object} UuidResponse
+// @Failure      400  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/addressbook/groups [post]
+// @Security     ApiKeyAuth
+func (a *AddressBookController) HandleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	a.HandleUpsertGroupRaw(w, r, tools.UUIDGen())
+}
+
+func (a *AddressBookController) HandleUpsertGroupRaw(w http.ResponseWriter, r *http.Request, uuid *tools.UUID) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		a.log.Println("Unable to read body")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var m GroupData
+	err = json.Unmarshal(body, &m)
+	if err != nil {
+		a.log.Printf("Unable to parse body '%s'. Error: %v", string(body), err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if (m.Name == "") || (len(m.Members) == 0) || slices.Contains(m.Members, nil) {
+		a.log.Printf("Incorrect contents in body '%s'", string(body))
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Changing a group changes the notifications of all reminders which use the group. Therefore
+	// the lock on Reminders and Notifications has to be obtained first.
+	nWrite, remWrite := a.dbRemNotif.Lock()
+	defer a.dbRemNotif.Unlock()
+
+	repoWrite := repo.LockAndGetRepoRW(a.db, a.genWrite)
+	defer func() { a.db.Unlock() }()
+
+	existing, err := repoWrite.Get(uuid)
+	if err != nil {
+		a.log.Printf("error reading from db '%v'", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if existing != nil {
+		a.log.Printf("Id '%s' is already used by a recipient", uuid)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Groups contain recipients only, i.e. they can not be nested
+	for _, j := range m.Members {
+		member, err := repoWrite.Get(j)
+		if err != nil {
+			a.log.Printf("error reading from db '%v'", err)
+			http.Error(w, "Internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if member == nil {
+			t := fmt.Sprintf("recipient '%s' is unknown", j)
+			a.log.Println(t)
+			http.Error(w, t, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// As the members are no groups this only removes duplicates
+	members, err := repo.ExpandRecipients(repoWrite, m.Members)
+	if err != nil {
+		a.log.Printf("error reading from db '%v'", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	group := repo.RecipientGroup{
+		Id:      uuid,
+		Name:    m.Name,
+		Members: members,
+	}
+
+	err = logic.UpsertGroup(nWrite, remWrite, repoWrite, &group)
+	if err != nil {
+		a.log.Printf("error writing to db '%v'", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var resp UuidResponse = UuidResponse{
+		Uuid: uuid,
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		a.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	a.log.Printf("Recipient group with id '%s' created ", resp.Uuid)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
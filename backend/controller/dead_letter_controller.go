@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"notifier/logic"
+	"notifier/repo"
+	"notifier/tools"
+	"sort"
+)
+
+type DeadLetterListResponse struct {
+	DeadLetters []*repo.DeadLetter `json:"dead_letters"`
+}
+
+type DeadLetterController struct {
+	db       repo.DBSerializer
+	log      *log.Logger
+	genRead  func(repo.DbType) repo.DeadLetterRepoRead
+	genWrite func(repo.DbType) repo.DeadLetterRepoWrite
+}
+
+func NewDeadLetterController(l repo.DBSerializer, lg *log.Logger, g func(repo.DbType) *repo.BoltDeadLetterRepo) *DeadLetterController {
+	genR := func(db repo.DbType) repo.DeadLetterRepoRead {
+		return g(db)
+	}
+
+	genW := func(db repo.DbType) repo.DeadLetterRepoWrite {
+		return g(db)
+	}
+
+	return &DeadLetterController{
+		db:       l,
+		log:      lg,
+		genRead:  genR,
+		genWrite: genW,
+	}
+}
+
+func (d *DeadLetterController) AddHandlersWithAuth(authWrapper tools.AuthWrapperFunc) {
+	http.HandleFunc("GET /notifier/api/deadletter", authWrapper(d.HandleList))
+	http.HandleFunc("POST /notifier/api/deadletter/{uuid}/retry", authWrapper(d.HandleRetry))
+	http.HandleFunc("DELETE /notifier/api/deadletter/{uuid}", authWrapper(d.HandleDelete))
+}
+
+// @Summary      Get all dead letters
+// @Description  Get all notifications which could not be delivered as a JSON list. The list is sorted in ascending order with respect to failed_at
+// @Tags	     DeadLetter
+// @Success      200  {object} DeadLetterListResponse
+// @Failure      500  {object} string
+// @Router       /notifier/api/deadletter [get]
+// @Security     ApiKeyAuth
+func (d *DeadLetterController) HandleList(w http.ResponseWriter, r *http.Request) {
+	readRepo := repo.LockAndGetRepoR(d.db, d.genRead)
+	defer func() { d.db.RUnlock() }()
+
+	deadLetters, err := readRepo.Filter(func(*repo.DeadLetter) bool { return true })
+	if err != nil {
+		d.log.Printf("error listing dead letters: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	sort.SliceStable(deadLetters, func(i, j int) bool {
+		return deadLetters[i].FailedAt.Compare(deadLetters[j].FailedAt) == -1
+	})
+
+	resp := DeadLetterListResponse{
+		DeadLetters: deadLetters,
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		d.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	d.log.Println("Created list of all dead letters")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
+
+// @Summary      Retry a dead letter
+// @Description  Move the dead letter with the specified uuid back to the notifications. It is sent again at the next opportunity
+// @Tags	     DeadLetter
+// @Param        uuid   path  string  true  "UUID of dead letter"
+// @Success      200  {object} nil
+// @Failure      400  {object} string
+// @Failure      404  {object} string
+// @Failure      409  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/deadletter/{uuid}/retry [post]
+// @Security     ApiKeyAuth
+func (d *DeadLetterController) HandleRetry(w http.ResponseWriter, r *http.Request) {
+	uuidRaw := r.PathValue("uuid")
+
+	uuid, ok := tools.NewUuidFromString(uuidRaw)
+	if !ok {
+		d.log.Printf("Unable to parse '%s' into uuid", uuidRaw)
+		http.Error(w, "UUID not wellformed", http.StatusBadRequest)
+		return
+	}
+
+	// Dead letters are written by the warner while it holds the lock on the notification store.
+	// Therefore this lock is also used here.
+	nWrite, rRead := d.db.Lock()
+	defer func() { d.db.Unlock() }()
+
+	dWrite := repo.GetRepo(d.db, d.genWrite)
+
+	found, err := logic.RetryDeadLetter(nWrite, rRead, dWrite, uuid)
+	if errors.Is(err, logic.ErrReminderGone) {
+		d.log.Printf("Reminder of dead letter '%s' no longer exists", uuid)
+		http.Error(w, "Reminder no longer exists", http.StatusConflict)
+		return
+	}
+
+	if err != nil {
+		d.log.Printf("error retrying dead letter: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		d.log.Printf("Dead letter '%s' not found", uuid)
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	d.log.Printf("Dead letter with id '%s' scheduled for retry", uuid)
+}
+
+// @Summary      Discard a dead letter
+// @Description  Delete the dead letter with the specified uuid
+// @Tags	     DeadLetter
+// @Param        uuid   path  string  true  "UUID of dead letter"
+// @Success      200  {object} nil
+// @Failure      400  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/deadletter/{uuid} [delete]
+// @Security     ApiKeyAuth
+func (d *DeadLetterController) HandleDelete(w http.ResponseWriter, r *http.Request) {
+	uuidRaw := r.PathValue("uuid")
+
+	uuid, ok := tools.NewUuidFromString(uuidRaw)
+	if !ok {
+		d.log.Printf("Unable to parse '%s' into uuid", uuidRaw)
+		http.Error(w, "UUID not wellformed", http.StatusBadRequest)
+		return
+	}
+
+	dWrite := repo.LockAndGetRepoRW(d.db, d.genWrite)
+	defer func() { d.db.Unlock() }()
+
+	err := dWrite.Delete(uuid)
+	if err != nil {
+		d.log.Printf("error deleting dead letter: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	d.log.Printf("Dead letter with id '%s' discarded", uuid)
+}
@@ -4,31 +4,38 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"notifier/logic"
 	"notifier/repo"
 	"notifier/tools"
 	"time"
 )
 
 type ApiInfoResult struct {
-	Version    string         `json:"version_info"`
-	TimeZone   string         `json:"time_zone"`
-	ClientTime time.Time      `json:"client_time"`
-	Count      int            `json:"reminder_count"`
-	Metrics    map[string]int `json:"metrics"`
-	TokenTtl   int64          `json:"token_ttl"`
+	Version    string              `json:"version_info"`
+	TimeZone   string              `json:"time_zone"`
+	ClientTime time.Time           `json:"client_time"`
+	Count      int                 `json:"reminder_count"`
+	Metrics    map[string]int      `json:"metrics"`
+	TokenTtl   int64               `json:"token_ttl"`
+	Sandbox    bool                `json:"sandbox"`
+	Senders    []logic.SenderState `json:"sender_states"`
 }
 
 type GeneralController struct {
 	log             *log.Logger
 	dbl             repo.DBSerializer
 	metricCollector *tools.MetricsCollector
+	sandbox         bool
+	guard           *logic.SenderGuard
 }
 
-func NewGeneralController(s repo.DBSerializer, l *log.Logger, m *tools.MetricsCollector) *GeneralController {
+func NewGeneralController(s repo.DBSerializer, l *log.Logger, m *tools.MetricsCollector, sandbox bool, g *logic.SenderGuard) *GeneralController {
 	return &GeneralController{
 		log:             l,
 		dbl:             s,
 		metricCollector: m,
+		sandbox:         sandbox,
+		guard:           g,
 	}
 }
 
@@ -65,6 +72,8 @@ func (s *GeneralController) HandleInfo(w http.ResponseWriter, r *http.Request) {
 		Count:      countReminders(s.dbl),
 		Metrics:    s.metricCollector.GetMetrics(),
 		TokenTtl:   tools.TokenTtl,
+		Sandbox:    s.sandbox,
+		Senders:    s.guard.GetStates(),
 	}
 
 	data, err := json.Marshal(&resp)
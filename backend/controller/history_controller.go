@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"notifier/logic"
+	"notifier/repo"
+	"notifier/tools"
+	"strconv"
+	"time"
+)
+
+const defaultHistoryPageSize = 50
+const maxHistoryPageSize = 500
+
+type HistoryResponse struct {
+	Total   int                    `json:"total"`
+	Offset  int                    `json:"offset"`
+	Entries []*repo.DeliveryRecord `json:"entries"`
+}
+
+type HistoryController struct {
+	log     *log.Logger
+	history *logic.DeliveryHistory
+}
+
+func NewHistoryController(lg *log.Logger, h *logic.DeliveryHistory) *HistoryController {
+	return &HistoryController{
+		log:     lg,
+		history: h,
+	}
+}
+
+func (h *HistoryController) AddHandlersWithAuth(authWrapper tools.AuthWrapperFunc) {
+	http.HandleFunc("GET /notifier/api/history", authWrapper(h.HandleList))
+}
+
+func parseOptionalInt(r *http.Request, name string, defaultValue int) (int, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return defaultValue, true
+	}
+
+	val, err := strconv.Atoi(raw)
+	if (err != nil) || (val < 0) {
+		return 0, false
+	}
+
+	return val, true
+}
+
+func parseOptionalUuid(r *http.Request, name string) (*tools.UUID, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, true
+	}
+
+	return tools.NewUuidFromString(raw)
+}
+
+func parseOptionalTime(r *http.Request, name string) (*time.Time, bool) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return nil, true
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, false
+	}
+
+	return &t, true
+}
+
+// @Summary      Get the delivery history
+// @Description  Get the delivery history as a JSON list. The entries are sorted in descending order with respect to their time. All query parameters are optional.
+// @Tags	     History
+// @Param        offset     query  int     false  "number of matching entries to skip"
+// @Param        limit      query  int     false  "maximum number of entries to return. Default 50"
+// @Param        recipient  query  string  false  "only return entries for this recipient"
+// @Param        reminder   query  string  false  "only return entries for this reminder"
+// @Param        outcome    query  string  false  "only return entries with this outcome"
+// @Param        from       query  string  false  "only return entries which are not older than this RFC3339 timestamp"
+// @Param        to         query  string  false  "only return entries which are older than this RFC3339 timestamp"
+// @Success      200  {object} HistoryResponse
+// @Failure      400  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/history [get]
+// @Security     ApiKeyAuth
+func (h *HistoryController) HandleList(w http.ResponseWriter, r *http.Request) {
+	offset, ok := parseOptionalInt(r, "offset", 0)
+	if !ok {
+		h.log.Printf("Illegal offset parameter")
+		http.Error(w, "Illegal offset", http.StatusBadRequest)
+		return
+	}
+
+	limit, ok := parseOptionalInt(r, "limit", defaultHistoryPageSize)
+	if !ok || (limit == 0) || (limit > maxHistoryPageSize) {
+		h.log.Printf("Illegal limit parameter")
+		http.Error(w, "Illegal limit", http.StatusBadRequest)
+		return
+	}
+
+	recipient, ok := parseOptionalUuid(r, "recipient")
+	if !ok {
+		h.log.Printf("Illegal recipient parameter")
+		http.Error(w, "UUID not wellformed", http.StatusBadRequest)
+		return
+	}
+
+	reminder, ok := parseOptionalUuid(r, "reminder")
+	if !ok {
+		h.log.Printf("Illegal reminder parameter")
+		http.Error(w, "UUID not wellformed", http.StatusBadRequest)
+		return
+	}
+
+	from, ok := parseOptionalTime(r, "from")
+	if !ok {
+		h.log.Printf("Illegal from parameter")
+		http.Error(w, "Illegal from", http.StatusBadRequest)
+		return
+	}
+
+	to, ok := parseOptionalTime(r, "to")
+	if !ok {
+		h.log.Printf("Illegal to parameter")
+		http.Error(w, "Illegal to", http.StatusBadRequest)
+		return
+	}
+
+	outcome := r.URL.Query().Get("outcome")
+
+	filterFunc := func(d *repo.DeliveryRecord) bool {
+		if (recipient != nil) && !recipient.IsEqual(d.Recipient) {
+			return false
+		}
+
+		if (reminder != nil) && ((d.ReminderId == nil) || !reminder.IsEqual(d.ReminderId)) {
+			return false
+		}
+
+		if (outcome != "") && (outcome != d.Outcome) {
+			return false
+		}
+
+		if (from != nil) && d.Time.Before(*from) {
+			return false
+		}
+
+		if (to != nil) && !d.Time.Before(*to) {
+			return false
+		}
+
+		return true
+	}
+
+	entries, total, err := h.history.Filter(filterFunc, offset, limit)
+	if err != nil {
+		h.log.Printf("error reading delivery history: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := HistoryResponse{
+		Total:   total,
+		Offset:  offset,
+		Entries: entries,
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		h.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.log.Println("Created filtered list of delivery history")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
@@ -22,6 +22,8 @@ type ReminderData struct {
 	Spec        time.Time          `json:"spec"`
 	Description string             `json:"description"`
 	Recipients  []*tools.UUID      `json:"recipients"`
+	Priority    *repo.Priority     `json:"priority"`
+	Options     map[string]string  `json:"options"`
 }
 
 type GetResponseGeneric[T any] struct {
@@ -100,7 +102,7 @@ func (n *ReminderController) HandlePost(w http.ResponseWriter, r *http.Request)
 }
 
 // @Summary      Modify or create a reminder
-// @Description  Create a new or modify an existing reminder with the id specified in the path. This also regenerates all notifications currently associated with the reminder.
+// @Description  Create a new or modify an existing reminder with the id specified in the path. This also regenerates all notifications currently associated with the reminder. The priority ranges from -1 (low) to 2 (urgent). If it is omitted the existing value is kept.
 // @Tags	     Reminder
 // @Accept       json
 // @Param        uuid   path  string  true  "UUID of reminder"
@@ -177,6 +179,19 @@ func (n *ReminderController) HandleUpsert(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if (m.Priority != nil) && ((*m.Priority < repo.PriorityLow) || (*m.Priority > repo.PriorityUrgent)) {
+		n.log.Printf("Illegal priority: %d", *m.Priority)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	err = sms.ValidateReminderOptions(m.Options)
+	if err != nil {
+		n.log.Printf("Illegal options: %v", err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
 	// Make sure lock on Reminder and Notification store is always obtained first and
 	// only after that obtain a lock on the address book. CheckRecipients obtains this lock.
 	// This does prevent deadlocks.
@@ -196,6 +211,16 @@ func (n *ReminderController) HandleUpsert(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		if !ok {
+			// Recipient groups can be used in the same way as recipients
+			ok, err = n.addressBook.IsGroup(j)
+			if err != nil {
+				n.log.Printf("error accessing recipient info: %v", err)
+				http.Error(w, "Internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		if !ok {
 			t := fmt.Sprintf("recipient '%s' is unknown", j)
 			n.log.Println(t)
@@ -215,6 +240,25 @@ func (n *ReminderController) HandleUpsert(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	existing, err := writeRepo.Get(uuid)
+	if err != nil {
+		n.log.Printf("error reading reminder: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// Clients which do not know about priorities or options must not change them
+	priority := repo.PriorityNormal
+	if m.Priority != nil {
+		priority = *m.Priority
+	} else if existing != nil {
+		priority = existing.Priority
+	}
+
+	if (m.Options == nil) && (existing != nil) {
+		m.Options = existing.Options
+	}
+
 	reminder := repo.Reminder{
 		Id:          resp.Uuid,
 		Kind:        m.Kind,
@@ -223,9 +267,11 @@ func (n *ReminderController) HandleUpsert(w http.ResponseWriter, r *http.Request
 		Spec:        m.Spec,
 		Description: m.Description,
 		Recipients:  m.Recipients,
+		Priority:    priority,
+		Options:     m.Options,
 	}
 
-	err = logic.ChangeReminder(nWriteRepo, writeRepo, &reminder)
+	err = logic.ChangeReminder(nWriteRepo, writeRepo, &reminder, n.addressBook.ExpandRecipients)
 	if err != nil {
 		n.log.Printf("error updating reminders: %v", err)
 		http.Error(w, "Internal error", http.StatusInternalServerError)
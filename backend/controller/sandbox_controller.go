@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"notifier/sms"
+	"notifier/tools"
+)
+
+type SandboxMessagesResponse struct {
+	Messages []sms.CapturedMessage `json:"messages"`
+}
+
+type SandboxController struct {
+	log    *log.Logger
+	buffer *sms.CaptureBuffer
+}
+
+func NewSandboxController(l *log.Logger, b *sms.CaptureBuffer) *SandboxController {
+	return &SandboxController{
+		log:    l,
+		buffer: b,
+	}
+}
+
+func (s *SandboxController) AddHandlersWithAuth(authWrapper tools.AuthWrapperFunc) {
+	http.HandleFunc("GET /notifier/api/sandbox/messages", authWrapper(s.HandleList))
+	http.HandleFunc("DELETE /notifier/api/sandbox/messages", authWrapper(s.HandleClear))
+}
+
+// @Summary      Get captured messages
+// @Description  Returns the messages which would have been sent if sandbox mode were not active. The most recent message comes first. Only the most recent messages are kept. This endpoint only exists in sandbox mode.
+// @Tags	     Sandbox
+// @Success      200  {object} SandboxMessagesResponse
+// @Failure      500  {object} string
+// @Router       /notifier/api/sandbox/messages [get]
+// @Security     ApiKeyAuth
+func (s *SandboxController) HandleList(w http.ResponseWriter, r *http.Request) {
+	resp := SandboxMessagesResponse{
+		Messages: s.buffer.GetAll(),
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		s.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	s.log.Printf("Returning %d captured messages", len(resp.Messages))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
+
+// @Summary      Delete captured messages
+// @Description  Deletes all messages which were captured in sandbox mode. This endpoint only exists in sandbox mode.
+// @Tags	     Sandbox
+// @Success      200  {object} nil
+// @Router       /notifier/api/sandbox/messages [delete]
+// @Security     ApiKeyAuth
+func (s *SandboxController) HandleClear(w http.ResponseWriter, r *http.Request) {
+	s.buffer.Clear()
+	s.log.Println("Deleted all captured messages")
+}
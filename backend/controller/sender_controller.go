@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"notifier/sms"
+	"notifier/tools"
+)
+
+type SenderHealthResponse struct {
+	Healthy bool               `json:"healthy"`
+	Senders []sms.SenderHealth `json:"senders"`
+}
+
+type SenderController struct {
+	log         *log.Logger
+	addressBook sms.SmsAddressBook
+	timeouts    *sms.SendTimeouts
+}
+
+func NewSenderController(l *log.Logger, a sms.SmsAddressBook, t *sms.SendTimeouts) *SenderController {
+	return &SenderController{
+		log:         l,
+		addressBook: a,
+		timeouts:    t,
+	}
+}
+
+func (s *SenderController) AddHandlersWithAuth(authWrapper tools.AuthWrapperFunc) {
+	http.HandleFunc("GET /notifier/api/senders", authWrapper(s.HandleProbe))
+}
+
+// @Summary      Check all senders
+// @Description  Probes the senders of all address types, e.g. by connecting and authenticating to the mail server. Senders which do not support probes are reported as healthy with probed set to false.
+// @Tags	     Senders
+// @Success      200  {object} SenderHealthResponse
+// @Failure      500  {object} string
+// @Router       /notifier/api/senders [get]
+// @Security     ApiKeyAuth
+func (s *SenderController) HandleProbe(w http.ResponseWriter, r *http.Request) {
+	resp := SenderHealthResponse{
+		Healthy: true,
+		Senders: sms.ProbeAllSenders(r.Context(), s.addressBook, s.timeouts),
+	}
+
+	for _, j := range resp.Senders {
+		if !j.Healthy {
+			s.log.Printf("Probe of sender for address type '%s' failed: %s", j.AddrType, j.Error)
+			resp.Healthy = false
+		}
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		s.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
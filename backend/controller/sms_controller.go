@@ -1,15 +1,19 @@
 package controller
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"notifier/logic"
+	"notifier/repo"
 	"notifier/sms"
 	"notifier/tools"
 	"slices"
 	"strings"
+	"time"
 )
 
 type SmsMessage struct {
@@ -19,6 +23,9 @@ type SmsMessage struct {
 type SmSController struct {
 	log         *log.Logger
 	addressBook sms.SmsAddressBook
+	history     *logic.DeliveryHistory
+	send        sms.SendFunc
+	usage       *logic.UsageTracker
 }
 
 type RecipientList struct {
@@ -26,10 +33,41 @@ type RecipientList struct {
 	DefaultIds    []string            `json:"default_ids"`
 }
 
-func NewSmsController(l *log.Logger, a sms.SmsAddressBook) *SmSController {
+func NewSmsController(l *log.Logger, a sms.SmsAddressBook, h *logic.DeliveryHistory, send sms.SendFunc, u *logic.UsageTracker) *SmSController {
 	return &SmSController{
 		log:         l,
 		addressBook: a,
+		history:     h,
+		send:        send,
+		usage:       u,
+	}
+}
+
+func (s *SmSController) recordDelivery(recipient *tools.UUID, channel *sms.Channel, message string, sendErr error) {
+	if s.history == nil {
+		return
+	}
+
+	record := repo.DeliveryRecord{
+		Recipient: recipient,
+		Message:   message,
+		Outcome:   repo.OutcomeSent,
+	}
+
+	if channel != nil {
+		record.SenderName = channel.Sender.GetName()
+		record.AddrType = channel.AddrType
+		record.Address = channel.Address
+	}
+
+	if sendErr != nil {
+		record.Outcome = repo.OutcomeFailed
+		record.Error = sendErr.Error()
+	}
+
+	err := s.history.Record(&record)
+	if err != nil {
+		s.log.Printf("Unable to record delivery: %v", err)
 	}
 }
 
@@ -39,13 +77,14 @@ func (s *SmSController) AddHandlersWithAuth(authWrapper tools.AuthWrapperFunc) {
 }
 
 // @Summary      Send a text message to a recipient
-// @Description  Send a text message specified in the body to the recipient specified in the URL
+// @Description  Send a text message specified in the body to the recipient specified in the URL. If the recipient is a group the message is sent to all members of the group. The rate limits and circuit breakers of the senders apply. 429 is returned if the message could not be sent to some recipients due to these restrictions
 // @Tags	     SMS
 // @Param        recipient   path  string  true  "Recipient"
 // @Param        message_spec  body  SmsMessage true "Specification of message to send"
 // @Success      200  {object} nil
 // @Failure      400  {object} string
 // @Failure      401  {object} string
+// @Failure      429  {object} string
 // @Failure      500  {object} string
 // @Router       /notifier/api/send/{recipient} [post]
 // @Security     ApiKeyAuth
@@ -59,15 +98,14 @@ func (s *SmSController) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ok, address, err := s.addressBook.CheckRecipient(recipient)
-
+	targets, err := s.determineTargets(recipient)
 	if err != nil {
 		s.log.Printf("error accessing recipient info: %v", err)
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
 
-	if !ok {
+	if targets == nil {
 		t := fmt.Sprintf("recipient '%s' is unknown", recipient)
 		s.log.Println(t)
 		http.Error(w, t, http.StatusBadRequest)
@@ -91,14 +129,97 @@ func (s *SmSController) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = s.addressBook.GetSender(recipient).Send(address, m.Message)
-	if err != nil {
-		s.log.Printf("Sending SMS failed: %v", err)
+	failed := false
+	blocked := false
+
+	for _, j := range targets {
+		err = s.sendOne(r.Context(), j, m.Message)
+		if err != nil {
+			s.log.Printf("Sending SMS to '%s' failed: %v", j, err)
+
+			if logic.IsBlocked(err) {
+				blocked = true
+			} else {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
 		http.Error(w, "Internal error", http.StatusInternalServerError)
 		return
 	}
 
-	s.log.Printf("SMS with message '%s' successfully sent", m.Message)
+	if blocked {
+		http.Error(w, "Rate limit reached or sender unavailable", http.StatusTooManyRequests)
+		return
+	}
+}
+
+// determineTargets returns the recipients which are addressed by the given id. If the id refers to a
+// group these are the group members. nil is returned if the id is unknown.
+func (s *SmSController) determineTargets(recipient *tools.UUID) ([]*tools.UUID, error) {
+	isGroup, err := s.addressBook.IsGroup(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	if isGroup {
+		return s.addressBook.ExpandRecipients([]*tools.UUID{recipient})
+	}
+
+	ok, _, err := s.addressBook.CheckRecipient(recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, nil
+	}
+
+	return []*tools.UUID{recipient}, nil
+}
+
+// sendOne is aborted if the request context is cancelled, e.g. because the client went away or the
+// server is shutting down
+func (s *SmSController) sendOne(ctx context.Context, recipient *tools.UUID, message string) error {
+	ok, channels, err := s.addressBook.CheckRecipient(recipient)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("recipient '%s' is unknown", recipient)
+	}
+
+	channel, err := sms.SendWithFallback(ctx, channels, message, &sms.MessageInfo{RecipientId: recipient}, s.send)
+	if err != nil {
+		if len(channels) > 0 {
+			s.recordDelivery(recipient, &channels[0], message, err)
+		}
+
+		if s.usage != nil {
+			countErr := s.usage.CountPartialDelivery(recipient, err, time.Now())
+			if countErr != nil {
+				s.log.Printf("Unable to count usage: %v", countErr)
+			}
+		}
+
+		return err
+	}
+
+	s.recordDelivery(recipient, channel, message, nil)
+
+	if s.usage != nil {
+		err = s.usage.Count(channel, recipient, message, time.Now())
+		if err != nil {
+			s.log.Printf("Unable to count usage: %v", err)
+		}
+	}
+
+	s.log.Printf("SMS with message '%s' successfully sent to '%s' via '%s'", message, recipient, channel.AddrType)
+
+	return nil
 }
 
 // @Summary      Retrieve all possible recipients
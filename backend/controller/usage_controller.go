@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"notifier/logic"
+	"notifier/tools"
+	"time"
+)
+
+type UsageController struct {
+	log   *log.Logger
+	usage *logic.UsageTracker
+}
+
+func NewUsageController(lg *log.Logger, u *logic.UsageTracker) *UsageController {
+	return &UsageController{
+		log:   lg,
+		usage: u,
+	}
+}
+
+func (u *UsageController) AddHandlersWithAuth(authWrapper tools.AuthWrapperFunc) {
+	http.HandleFunc("GET /notifier/api/usage", authWrapper(u.HandleGet))
+}
+
+// @Summary      Get usage statistics
+// @Description  Get the number of message segments which were sent per sender and per recipient in a calendar month. If month or year are missing the current month is used.
+// @Tags	     Usage
+// @Param        month    query     int  false  "month to look at"
+// @Param        year    query     int  false  "year to look at"
+// @Success      200  {object} logic.UsageStatistics
+// @Failure      400  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/usage [get]
+// @Security     ApiKeyAuth
+func (u *UsageController) HandleGet(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().In(tools.ClientTZ())
+
+	month, ok := parseOptionalInt(r, "month", int(now.Month()))
+	if !ok || (month < 1) || (month > 12) {
+		u.log.Printf("illegal month parameter: %s", r.URL.Query().Get("month"))
+		http.Error(w, "Illegal month", http.StatusBadRequest)
+		return
+	}
+
+	year, ok := parseOptionalInt(r, "year", now.Year())
+	if !ok || (year > 9999) {
+		u.log.Printf("illegal year parameter: %s", r.URL.Query().Get("year"))
+		http.Error(w, "Illegal year", http.StatusBadRequest)
+		return
+	}
+
+	stats, err := u.usage.GetStatistics(fmt.Sprintf("%04d-%02d", year, month))
+	if err != nil {
+		u.log.Printf("error reading usage statistics: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		u.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	u.log.Printf("Returning usage statistics for %s", stats.Month)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
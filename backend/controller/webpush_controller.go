@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"notifier/logic"
+	"notifier/repo"
+	"notifier/sms"
+	"notifier/tools"
+)
+
+type VapidKeyResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
+type WebPushSubscriptionData struct {
+	DisplayName  string                  `json:"display_name"`
+	Subscription sms.WebPushSubscription `json:"subscription"`
+}
+
+type WebPushController struct {
+	db        repo.DBSerializer
+	log       *log.Logger
+	publicKey string
+	genRead   func(repo.DbType) repo.AddrBookRead
+	genWrite  func(repo.DbType) repo.AddrBookWrite
+}
+
+func NewWebPushController(l repo.DBSerializer, lg *log.Logger, g func(repo.DbType) *repo.BBoltAddrBookRepo, publicKey string) *WebPushController {
+	genR := func(db repo.DbType) repo.AddrBookRead {
+		return g(db)
+	}
+
+	genW := func(db repo.DbType) repo.AddrBookWrite {
+		return g(db)
+	}
+
+	return &WebPushController{
+		db:        l,
+		log:       lg,
+		publicKey: publicKey,
+		genRead:   genR,
+		genWrite:  genW,
+	}
+}
+
+func (p *WebPushController) AddHandlersWithAuth(authWrapper tools.AuthWrapperFunc) {
+	http.HandleFunc("GET /notifier/api/webpush/key", authWrapper(p.HandleGetKey))
+	http.HandleFunc("POST /notifier/api/webpush/subscriptions", authWrapper(p.HandleSubscribe))
+}
+
+// @Summary      Get the VAPID public key
+// @Description  Get the public key which has to be used as the applicationServerKey when subscribing to push messages
+// @Tags	     WebPush
+// @Success      200  {object} VapidKeyResponse
+// @Failure      500  {object} string
+// @Router       /notifier/api/webpush/key [get]
+// @Security     ApiKeyAuth
+func (p *WebPushController) HandleGetKey(w http.ResponseWriter, r *http.Request) {
+	resp := VapidKeyResponse{
+		PublicKey: p.publicKey,
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		p.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
+
+// @Summary      Register a push subscription
+// @Description  Store the push subscription of a browser as an address book entry of the type WebPush. If a subscription with the same endpoint already exists, the existing entry is updated.
+// @Tags	     WebPush
+// @Accept       json
+// @Param        subscription_data  body  WebPushSubscriptionData true "Push subscription as returned by the browser"
+// @Success      200  {object} UuidResponse
+// @Failure      400  {object} string
+// @Failure      500  {object} string
+// @Router       /notifier/api/webpush/subscriptions [post]
+// @Security     ApiKeyAuth
+func (p *WebPushController) HandleSubscribe(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.log.Println("Unable to read body")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var m WebPushSubscriptionData
+	err = json.Unmarshal(body, &m)
+	if err != nil {
+		p.log.Printf("Unable to parse body '%s'. Error: %v", string(body), err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if m.DisplayName == "" {
+		p.log.Printf("Incorrect contents in body '%s'", string(body))
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	err = m.Subscription.Validate()
+	if err != nil {
+		p.log.Printf("Incorrect push subscription: %v", err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	address, err := json.Marshal(&m.Subscription)
+	if err != nil {
+		p.log.Printf("error serializing subscription: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	repoWrite := repo.LockAndGetRepoRW(p.db, p.genWrite)
+	defer func() { p.db.Unlock() }()
+
+	recipient, err := logic.FindWebPushSubscription(repoWrite, m.Subscription.Endpoint)
+	if err != nil {
+		p.log.Printf("error reading from db '%v'", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// A browser which subscribes again gets new keys for the same endpoint
+	if recipient == nil {
+		recipient = &repo.Recipient{
+			Id:       tools.UUIDGen(),
+			AddrType: sms.TypeWebPush,
+		}
+	}
+
+	recipient.DisplayName = m.DisplayName
+	recipient.Address = string(address)
+
+	err = repoWrite.Upsert(recipient)
+	if err != nil {
+		p.log.Printf("error writing to db '%v'", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := UuidResponse{
+		Uuid: recipient.Id,
+	}
+
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		p.log.Printf("error serializing response: %v", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	p.log.Printf("Push subscription stored in address book entry with id '%s'", recipient.Id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(data))
+}
@@ -0,0 +1,31 @@
+package logic
+
+import (
+	"fmt"
+	"notifier/repo"
+	"notifier/tools"
+	"time"
+)
+
+// DeferNotification postpones the delivery of the notification with the given id until the specified
+// time. This is not counted as a failed attempt. The first return value is false if the notification
+// does not exist anymore.
+func DeferNotification(nWrite repo.NotificationRepoWrite, id *tools.UUID, until time.Time) (bool, error) {
+	notification, err := nWrite.Get(id)
+	if err != nil {
+		return false, err
+	}
+
+	if notification == nil {
+		return false, nil
+	}
+
+	notification.NextAttempt = until.UTC()
+
+	err = nWrite.Upsert(notification)
+	if err != nil {
+		return false, fmt.Errorf("unable to defer notification: %v", err)
+	}
+
+	return true, nil
+}
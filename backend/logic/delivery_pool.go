@@ -0,0 +1,163 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"notifier/sms"
+	"notifier/tools"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultSenderConcurrency = 1
+const metricsQueuePrefix = "queue"
+const metricsLatencyPrefix = "latency_ms"
+
+// DeliveryPool limits the number of messages which are sent concurrently through each sender.
+// The limits are defined per sender name, i.e. the value returned by SmsSender.GetName().
+type DeliveryPool struct {
+	defaultLimit int
+	limits       map[string]int
+	mutex        *sync.Mutex
+	semaphores   map[string]chan struct{}
+	waiting      map[string]int
+	setValue     tools.SetMetricsValue
+	timeouts     *sms.SendTimeouts
+	guard        *SenderGuard
+}
+
+func NewDeliveryPool(limits map[string]int, defaultLimit int, m tools.SetMetricsValue) *DeliveryPool {
+	if defaultLimit < 1 {
+		defaultLimit = DefaultSenderConcurrency
+	}
+
+	return &DeliveryPool{
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		mutex:        new(sync.Mutex),
+		semaphores:   map[string]chan struct{}{},
+		waiting:      map[string]int{},
+		setValue:     m,
+		timeouts:     sms.NewSendTimeouts(nil, sms.DefaultSendTimeout),
+	}
+}
+
+// SetTimeouts defines how long each sender is allowed to take for sending a message. The time spent
+// waiting for a free slot is not taken into account.
+func (d *DeliveryPool) SetTimeouts(t *sms.SendTimeouts) {
+	d.timeouts = t
+}
+
+// SetGuard makes the pool enforce the rate limits and circuit breakers of the given guard
+func (d *DeliveryPool) SetGuard(g *SenderGuard) {
+	d.guard = g
+}
+
+// ParseSenderLimits parses a specification like "Mail=2,MQTT=10,IFTTT=1" into a map which
+// can be used to create a DeliveryPool.
+func ParseSenderLimits(spec string) (map[string]int, error) {
+	raw, err := tools.ParseKeyValueList(spec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse sender limits: %v", err)
+	}
+
+	res := map[string]int{}
+
+	for i, j := range raw {
+		limit, err := strconv.Atoi(j)
+		if (err != nil) || (limit < 1) {
+			return nil, fmt.Errorf("illegal limit '%s' for sender '%s'", j, i)
+		}
+
+		res[i] = limit
+	}
+
+	return res, nil
+}
+
+func (d *DeliveryPool) GetLimit(senderName string) int {
+	limit, ok := d.limits[senderName]
+	if !ok {
+		return d.defaultLimit
+	}
+
+	return limit
+}
+
+func (d *DeliveryPool) reportValue(name string, value int) {
+	if d.setValue != nil {
+		d.setValue(name, value)
+	}
+}
+
+// acquire waits for a free slot of the sender. It returns an error if ctx is done before a slot
+// becomes available.
+func (d *DeliveryPool) acquire(ctx context.Context, senderName string) (chan struct{}, error) {
+	d.mutex.Lock()
+	sem, ok := d.semaphores[senderName]
+	if !ok {
+		sem = make(chan struct{}, d.GetLimit(senderName))
+		d.semaphores[senderName] = sem
+	}
+	d.waiting[senderName]++
+	d.reportValue(fmt.Sprintf("%s:%s", metricsQueuePrefix, senderName), d.waiting[senderName])
+	d.mutex.Unlock()
+
+	var err error = nil
+
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	d.mutex.Lock()
+	d.waiting[senderName]--
+	d.reportValue(fmt.Sprintf("%s:%s", metricsQueuePrefix, senderName), d.waiting[senderName])
+	d.mutex.Unlock()
+
+	return sem, err
+}
+
+// Send waits until the sender has a free slot and then uses it to send the message within the
+// timeout of the sender. The time needed to actually send the message is reported as a metric. If
+// a guard is set, messages which exceed a rate limit or which are sent while the circuit breaker of
+// the sender is open are rejected with ErrSenderBlocked. For messages which were split into several
+// parts the rate limit is checked for all parts when the first part is sent.
+func (d *DeliveryPool) Send(ctx context.Context, sender sms.SmsSender, recipientAddress string, message string, info *sms.MessageInfo) error {
+	senderName := sender.GetName()
+
+	// The limits were already checked for all parts of the message when its first part was sent
+	if (d.guard != nil) && !info.FollowUp {
+		err := d.guard.Admit(ctx, sender, d.timeouts, max(1, info.PendingParts))
+		if err != nil {
+			return err
+		}
+	}
+
+	sem, err := d.acquire(ctx, senderName)
+	if err != nil {
+		if d.guard != nil {
+			d.guard.Abort(senderName)
+		}
+
+		return err
+	}
+	defer func() { <-sem }()
+
+	start := time.Now()
+	err = d.timeouts.Send(ctx, sender, recipientAddress, message, info)
+	d.reportValue(fmt.Sprintf("%s:%s", metricsLatencyPrefix, senderName), int(time.Since(start).Milliseconds()))
+
+	if d.guard != nil {
+		// Messages which were aborted from the outside say nothing about the state of the sender
+		if (err != nil) && (ctx.Err() != nil) {
+			d.guard.Abort(senderName)
+		} else {
+			d.guard.Record(senderName, err)
+		}
+	}
+
+	return err
+}
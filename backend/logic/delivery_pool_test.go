@@ -0,0 +1,83 @@
+package logic
+
+import (
+	"context"
+	"notifier/sms"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type slowSender struct {
+	name      string
+	current   atomic.Int32
+	maxSeen   atomic.Int32
+	sentCount atomic.Int32
+}
+
+func (s *slowSender) GetName() string {
+	return s.name
+}
+
+func (s *slowSender) Send(ctx context.Context, recipientAddress string, message string, info *sms.MessageInfo) error {
+	c := s.current.Add(1)
+	defer s.current.Add(-1)
+
+	for {
+		m := s.maxSeen.Load()
+		if (c <= m) || s.maxSeen.CompareAndSwap(m, c) {
+			break
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	s.sentCount.Add(1)
+
+	return nil
+}
+
+func TestParseSenderLimits(t *testing.T) {
+	limits, err := ParseSenderLimits("Mail=2, MQTT=10,IFTTT=1")
+	if err != nil {
+		t.Fatalf("Parsing failed: %v", err)
+	}
+
+	if (limits["Mail"] != 2) || (limits["MQTT"] != 10) || (limits["IFTTT"] != 1) {
+		t.Errorf("Wrong limits: %v", limits)
+	}
+
+	_, err = ParseSenderLimits("Mail=0")
+	if err == nil {
+		t.Errorf("A limit of zero should not be accepted")
+	}
+
+	_, err = ParseSenderLimits("Mail")
+	if err == nil {
+		t.Errorf("An entry without value should not be accepted")
+	}
+}
+
+func TestDeliveryPoolLimit(t *testing.T) {
+	sender := &slowSender{name: "Mail"}
+	pool := NewDeliveryPool(map[string]int{"Mail": 2}, 1, nil)
+	var wg sync.WaitGroup
+
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = pool.Send(context.Background(), sender, "a", "b", &sms.MessageInfo{})
+		}()
+	}
+
+	wg.Wait()
+
+	if sender.sentCount.Load() != 8 {
+		t.Errorf("Wrong number of messages sent: %d", sender.sentCount.Load())
+	}
+
+	if sender.maxSeen.Load() > 2 {
+		t.Errorf("Concurrency limit exceeded: %d", sender.maxSeen.Load())
+	}
+}
@@ -125,6 +125,7 @@ func (g *GenericNotificationGenerator) Reschedule(r *repo.Reminder) ([]*repo.Not
 			n.Parent = r.Id
 			n.Description = g.genNotifText[getNotifierIndex(r.Param)](j.prefix, eventLocalTime.Hour(), eventLocalTime.Minute(), r.Description)
 			n.WarningTime = j.t
+			n.EventTime = refTime
 			n.Recipient = i
 
 			res = append(res, n)
@@ -3,6 +3,7 @@ package logic
 import (
 	"notifier/repo"
 	"notifier/tools"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -49,6 +50,12 @@ func TestRescheduleOneShot(t *testing.T) {
 	if len(notifications) != 6 {
 		t.Errorf("Wrong number of notifications: %d", len(notifications))
 	}
+
+	for _, j := range notifications {
+		if !j.EventTime.Equal(rem.Spec) {
+			t.Errorf("Wrong event time: %v", j.EventTime)
+		}
+	}
 }
 
 func TestRescheduleOneShotWithoutTimestamp(t *testing.T) {
@@ -71,3 +78,50 @@ func TestRescheduleOneShotWithoutTimestamp(t *testing.T) {
 		t.Errorf("Timestamp should not be there!")
 	}
 }
+
+func TestDeleteSubstitute(t *testing.T) {
+	db, err := repo.InitDB(filepath.Join(t.TempDir(), "delete.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dbl := repo.NewBoltDBLocker(db)
+	addrRepo := repo.NewBBoltAddressBookRepo(db)
+	substituteId := tools.UUIDGen()
+	recipientId := tools.UUIDGen()
+	now := time.Now().UTC()
+
+	err = addrRepo.Upsert(&repo.Recipient{Id: substituteId, DisplayName: "Substitute", Address: "1", AddrType: "IFTTT"})
+	if err == nil {
+		err = addrRepo.Upsert(&repo.Recipient{
+			Id:          recipientId,
+			DisplayName: "Absent",
+			Address:     "2",
+			AddrType:    "IFTTT",
+			Absences: []repo.Absence{
+				{Start: now, End: now.Add(time.Hour), Policy: repo.AbsenceRedirect, Substitute: substituteId},
+				{Start: now.Add(2 * time.Hour), End: now.Add(3 * time.Hour), Policy: repo.AbsenceSuppress},
+			},
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nWrite, rWrite := dbl.Lock()
+	err = DeleteAddrBookEntry(nWrite, rWrite, addrRepo, substituteId)
+	dbl.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipient, err := addrRepo.Get(recipientId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (len(recipient.Absences) != 1) || (recipient.Absences[0].Policy != repo.AbsenceSuppress) {
+		t.Errorf("Absence with deleted substitute not removed: %v", recipient.Absences)
+	}
+}
@@ -0,0 +1,66 @@
+package logic
+
+import (
+	"fmt"
+	"notifier/repo"
+	"notifier/tools"
+	"time"
+)
+
+const DefaultHistoryRetention = 90 * 24 * time.Hour
+
+// DeliveryHistory persists the outcome of all delivery attempts. The history uses its own lock, i.e.
+// it can be written while holding the locks for the notification store or the address book.
+type DeliveryHistory struct {
+	db        repo.DBSerializer
+	generator func(repo.DbType) repo.HistoryRepoWrite
+	retention time.Duration
+}
+
+func NewDeliveryHistory(l repo.DBSerializer, g func(repo.DbType) *repo.BoltHistoryRepo, retention time.Duration) *DeliveryHistory {
+	genW := func(db repo.DbType) repo.HistoryRepoWrite {
+		return g(db)
+	}
+
+	return &DeliveryHistory{
+		db:        l,
+		generator: genW,
+		retention: retention,
+	}
+}
+
+// Record stores a new delivery record. Id and time are set automatically if they are missing.
+func (h *DeliveryHistory) Record(d *repo.DeliveryRecord) error {
+	if d.Id == nil {
+		d.Id = tools.UUIDGen()
+	}
+
+	if d.Time.IsZero() {
+		d.Time = time.Now().UTC()
+	}
+
+	writeRepo := repo.LockAndGetRepoRW(h.db, h.generator)
+	defer func() { h.db.Unlock() }()
+
+	err := writeRepo.Add(d)
+	if err != nil {
+		return fmt.Errorf("unable to record delivery: %v", err)
+	}
+
+	return nil
+}
+
+// Purge removes all records which are older than the configured retention period
+func (h *DeliveryHistory) Purge(now time.Time) (int, error) {
+	writeRepo := repo.LockAndGetRepoRW(h.db, h.generator)
+	defer func() { h.db.Unlock() }()
+
+	return writeRepo.DeleteOlderThan(now.Add(-h.retention))
+}
+
+func (h *DeliveryHistory) Filter(p repo.DeliveryRecordPredicate, offset int, limit int) ([]*repo.DeliveryRecord, int, error) {
+	h.db.RLock()
+	defer func() { h.db.RUnlock() }()
+
+	return repo.GetRepo(h.db, h.generator).Filter(p, offset, limit)
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"notifier/repo"
 	"notifier/tools"
+	"slices"
 )
 
 func ReminderTypeToGenerator(k repo.ReminderType) (NotificationGenerator, error) {
@@ -22,11 +23,21 @@ func ReminderTypeToGenerator(k repo.ReminderType) (NotificationGenerator, error)
 	}
 }
 
-func ProcessNewUuid(repoNotify repo.NotificationRepoWrite, repoReminder repo.ReminderRepoWrite, reminder *repo.Reminder) error {
-	return ProcessOneUuid(repoNotify, repoReminder, reminder, true)
+// RecipientExpander replaces the ids of recipient groups by the ids of their members
+type RecipientExpander func(recipients []*tools.UUID) ([]*tools.UUID, error)
+
+// NewRecipientExpander returns an expander which uses the given repo. It does not obtain any lock.
+func NewRecipientExpander(addrBookRead repo.AddrBookRead) RecipientExpander {
+	return func(recipients []*tools.UUID) ([]*tools.UUID, error) {
+		return repo.ExpandRecipients(addrBookRead, recipients)
+	}
+}
+
+func ProcessNewUuid(repoNotify repo.NotificationRepoWrite, repoReminder repo.ReminderRepoWrite, reminder *repo.Reminder, expand RecipientExpander) error {
+	return ProcessOneUuid(repoNotify, repoReminder, reminder, true, expand)
 }
 
-func ProcessOneUuid(repoNotify repo.NotificationRepoWrite, repoReminder repo.ReminderRepoWrite, reminder *repo.Reminder, forceReschedule bool) error {
+func ProcessOneUuid(repoNotify repo.NotificationRepoWrite, repoReminder repo.ReminderRepoWrite, reminder *repo.Reminder, forceReschedule bool, expand RecipientExpander) error {
 	c, err := repoNotify.CountSiblings(reminder.Id)
 	if err != nil {
 		return err
@@ -45,7 +56,15 @@ func ProcessOneUuid(repoNotify repo.NotificationRepoWrite, repoReminder repo.Rem
 		return repoReminder.Delete(reminder.Id)
 	}
 
-	newNotifications, err := proc.Reschedule(reminder)
+	// Groups are expanded when the notifications are generated. This way changes to a group
+	// take effect without having to edit the reminder.
+	expanded := *reminder
+	expanded.Recipients, err = expand(reminder.Recipients)
+	if err != nil {
+		return fmt.Errorf("unable to expand recipients: %v", err)
+	}
+
+	newNotifications, err := proc.Reschedule(&expanded)
 	if err != nil {
 		return err
 	}
@@ -70,7 +89,7 @@ func ProcessOneUuid(repoNotify repo.NotificationRepoWrite, repoReminder repo.Rem
 	return nil
 }
 
-func ProcessExpired(dbl repo.DBSerializer, extLog *log.Logger, uuidsToProcess []string) {
+func ProcessExpired(dbl repo.DBSerializer, extLog *log.Logger, uuidsToProcess []string, expand RecipientExpander) {
 	nRepo, rRepo := dbl.Lock()
 	defer func() { dbl.Unlock() }()
 
@@ -92,14 +111,14 @@ func ProcessExpired(dbl repo.DBSerializer, extLog *log.Logger, uuidsToProcess []
 			continue
 		}
 
-		err = ProcessOneUuid(nRepo, rRepo, reminder, false)
+		err = ProcessOneUuid(nRepo, rRepo, reminder, false, expand)
 		if err != nil {
 			extLog.Printf("Unable to reschedule reminder '%s': %v", j, err)
 		}
 	}
 }
 
-func ChangeReminder(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, reminder *repo.Reminder) error {
+func ChangeReminder(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, reminder *repo.Reminder, expand RecipientExpander) error {
 	err := repo.ClearNotifications(nWriteRepo, reminder.Id)
 	if err != nil {
 		return fmt.Errorf("error clearing possibly existing notifications: %v", err)
@@ -111,7 +130,7 @@ func ChangeReminder(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.Remind
 	}
 
 	// ToDo: Attempt to cleanup DB if this fails
-	err = ProcessNewUuid(nWriteRepo, writeRepo, reminder)
+	err = ProcessNewUuid(nWriteRepo, writeRepo, reminder, expand)
 	if err != nil {
 		return fmt.Errorf("error creating notifications for new/updated reminder: %v", err)
 	}
@@ -160,14 +179,61 @@ func TestAndRemoveRecipient(recipient *tools.UUID, recipients []*tools.UUID) ([]
 	return res, found
 }
 
-func DeleteAddrBookEntry(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, addrBookWriteRepo repo.AddrBookWrite, addrEntryId *tools.UUID) error {
-	affected, err := writeRepo.Filter(HasRecipient(addrEntryId))
+func IsGroupMember(recipientId *tools.UUID) repo.GroupPredicate {
+	return func(g *repo.RecipientGroup) bool {
+		for _, j := range g.Members {
+			if j.IsEqual(recipientId) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func usesSubstitute(substituteId *tools.UUID) repo.RecipientPredicate {
+	return func(r *repo.Recipient) bool {
+		for _, j := range r.Absences {
+			if (j.Substitute != nil) && j.Substitute.IsEqual(substituteId) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// removeSubstitute deletes all absences which redirect notifications to the given recipient
+func removeSubstitute(addrBookWriteRepo repo.AddrBookWrite, substituteId *tools.UUID) error {
+	recipients, err := addrBookWriteRepo.Filter(usesSubstitute(substituteId))
+	if err != nil {
+		return err
+	}
+
+	for _, j := range recipients {
+		j.Absences = slices.DeleteFunc(j.Absences, func(a repo.Absence) bool {
+			return (a.Substitute != nil) && a.Substitute.IsEqual(substituteId)
+		})
+
+		err = addrBookWriteRepo.Upsert(j)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeRecipientFromReminders removes the recipient or group from all reminders. Reminders which are
+// left without recipients are deleted.
+func removeRecipientFromReminders(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, recipientId *tools.UUID, expand RecipientExpander) error {
+	affected, err := writeRepo.Filter(HasRecipient(recipientId))
 	if err != nil {
 		return err
 	}
 
 	for _, j := range affected {
-		newRecipients, found := TestAndRemoveRecipient(addrEntryId, j.Recipients)
+		newRecipients, found := TestAndRemoveRecipient(recipientId, j.Recipients)
 		if found {
 			if len(newRecipients) == 0 {
 				err := RemoveReminder(nWriteRepo, writeRepo, j.Id)
@@ -176,7 +242,7 @@ func DeleteAddrBookEntry(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.R
 				}
 			} else {
 				j.Recipients = newRecipients
-				err := ChangeReminder(nWriteRepo, writeRepo, j)
+				err := ChangeReminder(nWriteRepo, writeRepo, j, expand)
 				if err != nil {
 					return err
 				}
@@ -184,10 +250,99 @@ func DeleteAddrBookEntry(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.R
 		}
 	}
 
+	return nil
+}
+
+// regenerateNotifications recreates the notifications of all reminders which reference the given group
+func regenerateNotifications(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, groupId *tools.UUID, expand RecipientExpander) error {
+	affected, err := writeRepo.Filter(HasRecipient(groupId))
+	if err != nil {
+		return err
+	}
+
+	for _, j := range affected {
+		err := ChangeReminder(nWriteRepo, writeRepo, j, expand)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteAddrBookEntry removes the recipient from the address book, all groups and all reminders.
+// Groups which become empty are deleted as well.
+func DeleteAddrBookEntry(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, addrBookWriteRepo repo.AddrBookWrite, addrEntryId *tools.UUID) error {
+	removedIds := []*tools.UUID{addrEntryId}
+	changedGroups := []*tools.UUID{}
+
+	groups, err := addrBookWriteRepo.FilterGroups(IsGroupMember(addrEntryId))
+	if err != nil {
+		return err
+	}
+
+	for _, j := range groups {
+		j.Members, _ = TestAndRemoveRecipient(addrEntryId, j.Members)
+		if len(j.Members) == 0 {
+			err = addrBookWriteRepo.DeleteGroup(j.Id)
+			removedIds = append(removedIds, j.Id)
+		} else {
+			err = addrBookWriteRepo.UpsertGroup(j)
+			changedGroups = append(changedGroups, j.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = removeSubstitute(addrBookWriteRepo, addrEntryId)
+	if err != nil {
+		return err
+	}
+
+	// The address book has to be up to date before notifications are regenerated, because the
+	// groups are expanded at that point
 	err = addrBookWriteRepo.Delete(addrEntryId)
 	if err != nil {
 		return err
 	}
 
+	expand := NewRecipientExpander(addrBookWriteRepo)
+
+	for _, j := range removedIds {
+		err = removeRecipientFromReminders(nWriteRepo, writeRepo, j, expand)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, j := range changedGroups {
+		err = regenerateNotifications(nWriteRepo, writeRepo, j, expand)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// UpsertGroup stores the group and recreates the notifications of all reminders which use it
+func UpsertGroup(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, addrBookWriteRepo repo.AddrBookWrite, group *repo.RecipientGroup) error {
+	err := addrBookWriteRepo.UpsertGroup(group)
+	if err != nil {
+		return err
+	}
+
+	return regenerateNotifications(nWriteRepo, writeRepo, group.Id, NewRecipientExpander(addrBookWriteRepo))
+}
+
+// DeleteGroup removes the group from the address book and all reminders
+func DeleteGroup(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, addrBookWriteRepo repo.AddrBookWrite, groupId *tools.UUID) error {
+	err := addrBookWriteRepo.DeleteGroup(groupId)
+	if err != nil {
+		return err
+	}
+
+	return removeRecipientFromReminders(nWriteRepo, writeRepo, groupId, NewRecipientExpander(addrBookWriteRepo))
+}
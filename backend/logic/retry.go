@@ -0,0 +1,180 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"notifier/repo"
+	"notifier/sms"
+	"notifier/tools"
+	"time"
+)
+
+const DefaultMaxSendAttempts = 10
+const DefaultRetryBaseDelay = time.Minute
+const DefaultRetryMaxDelay = 6 * time.Hour
+
+// ErrReminderGone is returned when a dead letter is retried whose reminder no longer exists
+var ErrReminderGone = errors.New("reminder of dead letter no longer exists")
+
+// RetryPolicy determines when a failed notification is sent again and after how many failed attempts
+// it is moved to the dead letter store.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func NewDefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: DefaultMaxSendAttempts,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+	}
+}
+
+// Delay returns the time to wait after the given number of failed attempts. The delay doubles with each
+// failed attempt until MaxDelay is reached.
+func (r *RetryPolicy) Delay(attempts int) time.Duration {
+	delay := r.BaseDelay
+
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= r.MaxDelay {
+			return r.MaxDelay
+		}
+	}
+
+	return min(delay, r.MaxDelay)
+}
+
+func (r *RetryPolicy) IsExhausted(attempts int) bool {
+	return attempts >= r.MaxAttempts
+}
+
+// RecordFailedAttempt updates the notification with the given id after a failed delivery attempt. It
+// either schedules a retry or moves the notification to the dead letter store. If the message was
+// only partially delivered, the notification is changed to contain the rest of the message. The first
+// return value is true if the notification was moved to the dead letter store.
+func RecordFailedAttempt(nWrite repo.NotificationRepoWrite, dWrite repo.DeadLetterRepoWrite, policy *RetryPolicy, id *tools.UUID, sendErr error, now time.Time) (bool, error) {
+	notification, err := nWrite.Get(id)
+	if err != nil {
+		return false, err
+	}
+
+	if notification == nil {
+		// Notification was deleted in the meantime
+		return false, nil
+	}
+
+	notification.Attempts++
+	notification.LastError = sendErr.Error()
+
+	// Parts which were already delivered are not sent again
+	var partial *sms.PartialDeliveryError
+	if errors.As(sendErr, &partial) {
+		notification.Description = partial.Remaining
+	}
+
+	if policy.IsExhausted(notification.Attempts) {
+		err = MoveToDeadLetters(nWrite, dWrite, notification, now)
+		if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	notification.NextAttempt = now.Add(policy.Delay(notification.Attempts)).UTC()
+
+	err = nWrite.Upsert(notification)
+	if err != nil {
+		return false, fmt.Errorf("unable to schedule retry: %v", err)
+	}
+
+	return false, nil
+}
+
+// RecordPartialDelivery changes the notification with the given id to contain only the rest of its
+// message if sendErr is a PartialDeliveryError. Otherwise nothing is changed.
+func RecordPartialDelivery(nWrite repo.NotificationRepoWrite, id *tools.UUID, sendErr error) error {
+	var partial *sms.PartialDeliveryError
+	if !errors.As(sendErr, &partial) {
+		return nil
+	}
+
+	notification, err := nWrite.Get(id)
+	if (err != nil) || (notification == nil) {
+		return err
+	}
+
+	notification.Description = partial.Remaining
+
+	err = nWrite.Upsert(notification)
+	if err != nil {
+		return fmt.Errorf("unable to record partial delivery: %v", err)
+	}
+
+	return nil
+}
+
+func MoveToDeadLetters(nWrite repo.NotificationRepoWrite, dWrite repo.DeadLetterRepoWrite, notification *repo.Notification, now time.Time) error {
+	deadLetter := repo.DeadLetter{
+		Notification: notification,
+		FailedAt:     now.UTC(),
+		LastError:    notification.LastError,
+	}
+
+	err := dWrite.Upsert(&deadLetter)
+	if err != nil {
+		return fmt.Errorf("unable to store dead letter: %v", err)
+	}
+
+	err = nWrite.Delete(notification.Id)
+	if err != nil {
+		return fmt.Errorf("unable to remove dead letter from notifications: %v", err)
+	}
+
+	return nil
+}
+
+// RetryDeadLetter moves the dead letter with the given id back into the notification store. The attempt
+// counter is reset, i.e. the notification is sent at the next tick of the warner. The first return value
+// is false if the dead letter does not exist. If the reminder of the dead letter was deleted in the
+// meantime ErrReminderGone is returned and the dead letter is kept.
+func RetryDeadLetter(nWrite repo.NotificationRepoWrite, rRead repo.ReminderRepoRead, dWrite repo.DeadLetterRepoWrite, id *tools.UUID) (bool, error) {
+	deadLetter, err := dWrite.Get(id)
+	if err != nil {
+		return false, err
+	}
+
+	if deadLetter == nil {
+		return false, nil
+	}
+
+	notification := deadLetter.Notification
+
+	reminder, err := rRead.Get(notification.Parent)
+	if err != nil {
+		return false, err
+	}
+
+	if reminder == nil {
+		return false, ErrReminderGone
+	}
+
+	notification.Attempts = 0
+	notification.NextAttempt = time.Time{}
+	notification.LastError = ""
+
+	err = nWrite.Upsert(notification)
+	if err != nil {
+		return false, fmt.Errorf("unable to restore notification: %v", err)
+	}
+
+	err = dWrite.Delete(id)
+	if err != nil {
+		return false, fmt.Errorf("unable to remove dead letter: %v", err)
+	}
+
+	return true, nil
+}
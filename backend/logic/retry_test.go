@@ -0,0 +1,74 @@
+package logic
+
+import (
+	"errors"
+	"notifier/repo"
+	"notifier/tools"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Minute,
+		MaxDelay:    10 * time.Minute,
+	}
+
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+
+	for i, j := range expected {
+		if d := policy.Delay(i + 1); d != j {
+			t.Errorf("Wrong delay after %d attempts: %v", i+1, d)
+		}
+	}
+
+	if policy.IsExhausted(4) || !policy.IsExhausted(5) {
+		t.Errorf("Wrong number of allowed attempts")
+	}
+}
+
+func TestRetryDeadLetterWithoutReminder(t *testing.T) {
+	db, err := repo.InitDB(filepath.Join(t.TempDir(), "retry.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dbl := repo.NewBoltDBLocker(db)
+	dWrite := repo.NewBBoltDeadLetterRepo(db)
+	id := tools.UUIDGen()
+
+	err = dWrite.Upsert(&repo.DeadLetter{
+		Notification: &repo.Notification{
+			Id:          id,
+			Parent:      tools.UUIDGen(),
+			Description: "Dentist today",
+			Recipient:   tools.UUIDGen(),
+			Attempts:    10,
+		},
+		FailedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nWrite, rWrite := dbl.Lock()
+	found, err := RetryDeadLetter(nWrite, rWrite, dWrite, id)
+	dbl.Unlock()
+
+	if found || !errors.Is(err, ErrReminderGone) {
+		t.Fatalf("Dead letter of deleted reminder was retried: %v %v", found, err)
+	}
+
+	deadLetter, err := dWrite.Get(id)
+	if (err != nil) || (deadLetter == nil) {
+		t.Errorf("Dead letter was removed: %v", err)
+	}
+
+	notification, err := nWrite.Get(id)
+	if (err != nil) || (notification != nil) {
+		t.Errorf("Notification was restored: %v", err)
+	}
+}
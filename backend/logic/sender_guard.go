@@ -0,0 +1,356 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"notifier/sms"
+	"notifier/tools"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultBreakerThreshold = 5
+const DefaultBreakerCooldown = 5 * time.Minute
+const metricsBreakerPrefix = "breaker"
+
+// States of a circuit breaker
+const BreakerClosed = "closed"
+const BreakerOpen = "open"
+const BreakerHalfOpen = "half-open"
+
+// ErrSenderBlocked is returned when a message was not sent because a rate limit was reached or because
+// the circuit breaker of the sender is open. Such messages have to be sent again later.
+var ErrSenderBlocked = errors.New("sender blocked")
+
+// RateLimit defines how many messages a sender is allowed to send per minute, hour and day. Zero
+// means that there is no limit for the respective period.
+type RateLimit struct {
+	PerMinute int
+	PerHour   int
+	PerDay    int
+}
+
+// SenderState describes the circuit breaker and the recent usage of a sender
+type SenderState struct {
+	Sender              string    `json:"sender"`
+	Breaker             string    `json:"breaker"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	RetryAt             time.Time `json:"retry_at,omitzero"`
+	SentLastMinute      int       `json:"sent_last_minute"`
+	SentLastHour        int       `json:"sent_last_hour"`
+	SentLastDay         int       `json:"sent_last_day"`
+}
+
+type senderGuardState struct {
+	sent      []time.Time
+	breaker   string
+	failures  int
+	openUntil time.Time
+	// Is true while a message or a probe checks whether an open breaker can be closed again
+	trialRunning bool
+}
+
+// SenderGuard enforces rate limits per sender and stops using a sender for some time after it has failed
+// repeatedly (circuit breaker). When this time has passed the sender is probed if it supports probes.
+// Otherwise the next message is used as a trial. Senders are identified by their name, i.e. the value
+// returned by SmsSender.GetName().
+type SenderGuard struct {
+	mutex     *sync.Mutex
+	limits    map[string]RateLimit
+	threshold int
+	cooldown  time.Duration
+	senders   map[string]*senderGuardState
+	setValue  tools.SetMetricsValue
+	now       func() time.Time
+}
+
+func NewSenderGuard(limits map[string]RateLimit, threshold int, cooldown time.Duration, m tools.SetMetricsValue) *SenderGuard {
+	if threshold < 1 {
+		threshold = DefaultBreakerThreshold
+	}
+
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	return &SenderGuard{
+		mutex:     new(sync.Mutex),
+		limits:    limits,
+		threshold: threshold,
+		cooldown:  cooldown,
+		senders:   map[string]*senderGuardState{},
+		setValue:  m,
+		now:       time.Now,
+	}
+}
+
+// ParseRateLimits parses a specification like "IFTTT=10/m;100/h;500/d,local=30/m" into a map which
+// can be used to create a SenderGuard
+func ParseRateLimits(spec string) (map[string]RateLimit, error) {
+	raw, err := tools.ParseKeyValueList(spec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse rate limits: %v", err)
+	}
+
+	res := map[string]RateLimit{}
+
+	for i, j := range raw {
+		limit := RateLimit{}
+
+		for _, k := range strings.Split(j, ";") {
+			countStr, period, found := strings.Cut(strings.TrimSpace(k), "/")
+			count, err := strconv.Atoi(countStr)
+			if !found || (err != nil) || (count < 1) {
+				return nil, fmt.Errorf("illegal rate limit '%s' for sender '%s'", k, i)
+			}
+
+			switch period {
+			case "m":
+				limit.PerMinute = count
+			case "h":
+				limit.PerHour = count
+			case "d":
+				limit.PerDay = count
+			default:
+				return nil, fmt.Errorf("illegal period '%s' for sender '%s'", period, i)
+			}
+		}
+
+		res[i] = limit
+	}
+
+	return res, nil
+}
+
+func (g *SenderGuard) GetLimit(senderName string) RateLimit {
+	return g.limits[senderName]
+}
+
+func (g *SenderGuard) getState(senderName string) *senderGuardState {
+	state, ok := g.senders[senderName]
+	if !ok {
+		state = &senderGuardState{
+			breaker: BreakerClosed,
+		}
+		g.senders[senderName] = state
+	}
+
+	return state
+}
+
+func (g *SenderGuard) setBreaker(senderName string, state *senderGuardState, breaker string) {
+	state.breaker = breaker
+
+	if g.setValue == nil {
+		return
+	}
+
+	value := 0
+	switch breaker {
+	case BreakerOpen:
+		value = 1
+	case BreakerHalfOpen:
+		value = 2
+	}
+
+	g.setValue(fmt.Sprintf("%s:%s", metricsBreakerPrefix, senderName), value)
+}
+
+func (g *SenderGuard) open(senderName string, state *senderGuardState) {
+	state.openUntil = g.now().Add(g.cooldown)
+	state.trialRunning = false
+	g.setBreaker(senderName, state, BreakerOpen)
+}
+
+// countSince returns the number of messages which were sent after the given point in time
+func (s *senderGuardState) countSince(t time.Time) int {
+	res := 0
+
+	for _, j := range s.sent {
+		if j.After(t) {
+			res++
+		}
+	}
+
+	return res
+}
+
+// checkRateLimit returns an error if sending count more messages would exceed the rate limit. Otherwise
+// the messages are counted. If nothing was sent in a period, count may exceed the limit of that period.
+// Otherwise messages with more parts than the limit allows could never be sent.
+func (g *SenderGuard) checkRateLimit(senderName string, state *senderGuardState, count int) error {
+	now := g.now()
+	limit := g.GetLimit(senderName)
+
+	// Messages which were sent more than a day ago are no longer relevant
+	state.sent = slices.DeleteFunc(state.sent, func(t time.Time) bool {
+		return !t.After(now.Add(-24 * time.Hour))
+	})
+
+	periods := []struct {
+		max      int
+		duration time.Duration
+		name     string
+	}{
+		{limit.PerMinute, time.Minute, "minute"},
+		{limit.PerHour, time.Hour, "hour"},
+		{limit.PerDay, 24 * time.Hour, "day"},
+	}
+
+	for _, j := range periods {
+		used := state.countSince(now.Add(-j.duration))
+		if (j.max > 0) && (used > 0) && (used+count > j.max) {
+			return fmt.Errorf("%w: rate limit of %d messages per %s reached", ErrSenderBlocked, j.max, j.name)
+		}
+	}
+
+	for range count {
+		state.sent = append(state.sent, now)
+	}
+
+	return nil
+}
+
+// Admit returns nil if count messages may be sent through the sender. In this case the result of sending
+// each message has to be reported via Record or Abort. If the circuit breaker of the sender is open and
+// its cooldown has passed, the sender is probed before the messages are admitted.
+func (g *SenderGuard) Admit(ctx context.Context, sender sms.SmsSender, timeouts *sms.SendTimeouts, count int) error {
+	senderName := sender.GetName()
+
+	g.mutex.Lock()
+	state := g.getState(senderName)
+
+	if state.breaker != BreakerClosed {
+		if state.trialRunning || g.now().Before(state.openUntil) {
+			g.mutex.Unlock()
+			return fmt.Errorf("%w: circuit breaker of '%s' is open", ErrSenderBlocked, senderName)
+		}
+
+		state.trialRunning = true
+		g.setBreaker(senderName, state, BreakerHalfOpen)
+		g.mutex.Unlock()
+
+		health := sms.ProbeSender(ctx, "", sender, timeouts)
+
+		g.mutex.Lock()
+		if health.Probed {
+			if !health.Healthy {
+				g.open(senderName, state)
+				g.mutex.Unlock()
+				return fmt.Errorf("%w: probe of '%s' failed: %s", ErrSenderBlocked, senderName, health.Error)
+			}
+
+			state.failures = 0
+			state.trialRunning = false
+			g.setBreaker(senderName, state, BreakerClosed)
+		}
+	}
+
+	err := g.checkRateLimit(senderName, state, count)
+	if err != nil {
+		// The message can not be used as a trial
+		state.trialRunning = false
+	}
+	g.mutex.Unlock()
+
+	return err
+}
+
+// Record reports the result of sending an admitted message
+func (g *SenderGuard) Record(senderName string, sendErr error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	state := g.getState(senderName)
+
+	if sendErr == nil {
+		state.failures = 0
+		state.trialRunning = false
+		if state.breaker != BreakerClosed {
+			g.setBreaker(senderName, state, BreakerClosed)
+		}
+
+		return
+	}
+
+	state.failures++
+
+	if (state.breaker == BreakerHalfOpen) || ((state.breaker == BreakerClosed) && (state.failures >= g.threshold)) {
+		g.open(senderName, state)
+	}
+}
+
+// Abort has to be called instead of Record if an admitted message was not sent for reasons which are
+// unrelated to the sender, e.g. because the program is stopping
+func (g *SenderGuard) Abort(senderName string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	state := g.getState(senderName)
+	if state.breaker == BreakerHalfOpen {
+		state.trialRunning = false
+	}
+}
+
+// GetStates returns the state of all senders which were used so far sorted by sender name
+func (g *SenderGuard) GetStates() []SenderState {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := g.now()
+	res := []SenderState{}
+
+	for i, j := range g.senders {
+		s := SenderState{
+			Sender:              i,
+			Breaker:             j.breaker,
+			ConsecutiveFailures: j.failures,
+			SentLastMinute:      j.countSince(now.Add(-time.Minute)),
+			SentLastHour:        j.countSince(now.Add(-time.Hour)),
+			SentLastDay:         j.countSince(now.Add(-24 * time.Hour)),
+		}
+
+		if j.breaker == BreakerOpen {
+			s.RetryAt = j.openUntil.UTC()
+		}
+
+		res = append(res, s)
+	}
+
+	slices.SortFunc(res, func(a, b SenderState) int {
+		return strings.Compare(a.Sender, b.Sender)
+	})
+
+	return res
+}
+
+// IsBlocked returns true if err only contains errors which were caused by rate limits or open circuit
+// breakers, i.e. if no channel actually failed. A message which was partially delivered is not blocked
+// because its delivered parts have to be recorded.
+func IsBlocked(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var partial *sms.PartialDeliveryError
+	if errors.As(err, &partial) {
+		return false
+	}
+
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return errors.Is(err, ErrSenderBlocked)
+	}
+
+	for _, j := range joined.Unwrap() {
+		if !IsBlocked(j) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,247 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"notifier/sms"
+	"testing"
+	"time"
+)
+
+type flakySender struct {
+	name     string
+	fail     bool
+	probeErr error
+	sent     int
+}
+
+func (f *flakySender) GetName() string {
+	return f.name
+}
+
+func (f *flakySender) Send(ctx context.Context, recipientAddress string, message string, info *sms.MessageInfo) error {
+	if f.fail {
+		return fmt.Errorf("sender is down")
+	}
+
+	f.sent++
+
+	return nil
+}
+
+type probingFlakySender struct {
+	flakySender
+}
+
+func (p *probingFlakySender) Probe(ctx context.Context) error {
+	return p.probeErr
+}
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := ParseRateLimits("IFTTT=10/m;100/h;500/d, local=30/m")
+	if err != nil {
+		t.Fatalf("Parsing failed: %v", err)
+	}
+
+	if (limits["IFTTT"] != RateLimit{PerMinute: 10, PerHour: 100, PerDay: 500}) || (limits["local"] != RateLimit{PerMinute: 30}) {
+		t.Errorf("Wrong limits: %v", limits)
+	}
+
+	for _, j := range []string{"IFTTT=10", "IFTTT=0/m", "IFTTT=10/w", "IFTTT=x/m"} {
+		_, err = ParseRateLimits(j)
+		if err == nil {
+			t.Errorf("Illegal spec '%s' was accepted", j)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	guard := NewSenderGuard(map[string]RateLimit{"test": {PerMinute: 2, PerHour: 3}}, 0, 0, nil)
+	guard.now = func() time.Time { return now }
+
+	sender := &flakySender{name: "test"}
+	pool := NewDeliveryPool(map[string]int{}, DefaultSenderConcurrency, nil)
+	pool.SetGuard(guard)
+
+	send := func() error {
+		return pool.Send(context.Background(), sender, "addr", "message", &sms.MessageInfo{})
+	}
+
+	if (send() != nil) || (send() != nil) {
+		t.Fatalf("Sending within the limits failed")
+	}
+
+	err := send()
+	if !errors.Is(err, ErrSenderBlocked) || !IsBlocked(err) {
+		t.Errorf("Limit per minute not enforced: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+
+	if send() != nil {
+		t.Errorf("Sending failed after a minute")
+	}
+
+	err = send()
+	if !errors.Is(err, ErrSenderBlocked) {
+		t.Errorf("Limit per hour not enforced: %v", err)
+	}
+
+	if sender.sent != 3 {
+		t.Errorf("Wrong number of messages sent: %d", sender.sent)
+	}
+
+	states := guard.GetStates()
+	if (len(states) != 1) || (states[0].SentLastMinute != 1) || (states[0].SentLastHour != 3) {
+		t.Errorf("Wrong states: %v", states)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	metrics := map[string]int{}
+	guard := NewSenderGuard(map[string]RateLimit{}, 2, time.Minute, func(name string, value int) { metrics[name] = value })
+	guard.now = func() time.Time { return now }
+
+	sender := &flakySender{name: "test", fail: true}
+	pool := NewDeliveryPool(map[string]int{}, DefaultSenderConcurrency, nil)
+	pool.SetGuard(guard)
+
+	send := func() error {
+		return pool.Send(context.Background(), sender, "addr", "message", &sms.MessageInfo{})
+	}
+
+	for range 2 {
+		err := send()
+		if (err == nil) || IsBlocked(err) {
+			t.Fatalf("Expected failure of sender: %v", err)
+		}
+	}
+
+	if (guard.GetStates()[0].Breaker != BreakerOpen) || (metrics["breaker:test"] != 1) {
+		t.Fatalf("Breaker not opened: %v", guard.GetStates())
+	}
+
+	sender.fail = false
+
+	if !IsBlocked(send()) {
+		t.Errorf("Message sent while breaker is open")
+	}
+
+	// The next message is used as a trial because the sender does not support probes. The trial fails.
+	now = now.Add(time.Minute)
+	sender.fail = true
+
+	err := send()
+	if (err == nil) || IsBlocked(err) {
+		t.Errorf("Trial message was not sent: %v", err)
+	}
+
+	if guard.GetStates()[0].Breaker != BreakerOpen {
+		t.Errorf("Breaker not opened again after a failed trial")
+	}
+
+	now = now.Add(time.Minute)
+	sender.fail = false
+
+	if send() != nil {
+		t.Errorf("Successful trial failed")
+	}
+
+	if (guard.GetStates()[0].Breaker != BreakerClosed) || (metrics["breaker:test"] != 0) {
+		t.Errorf("Breaker not closed after successful trial: %v", guard.GetStates())
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	guard := NewSenderGuard(map[string]RateLimit{}, 1, time.Minute, nil)
+	guard.now = func() time.Time { return now }
+
+	sender := &probingFlakySender{flakySender{name: "test", fail: true}}
+	pool := NewDeliveryPool(map[string]int{}, DefaultSenderConcurrency, nil)
+	pool.SetGuard(guard)
+
+	send := func() error {
+		return pool.Send(context.Background(), sender, "addr", "message", &sms.MessageInfo{})
+	}
+
+	send()
+	now = now.Add(time.Minute)
+	sender.probeErr = fmt.Errorf("still down")
+
+	err := send()
+	if !IsBlocked(err) {
+		t.Errorf("Message sent although probe failed: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	sender.probeErr = nil
+	sender.fail = false
+
+	if send() != nil {
+		t.Errorf("Message not sent after successful probe")
+	}
+
+	if guard.GetStates()[0].Breaker != BreakerClosed {
+		t.Errorf("Breaker not closed after successful probe")
+	}
+}
+
+func TestIsBlocked(t *testing.T) {
+	blocked := fmt.Errorf("sending via 'IFTTT' failed: %w", fmt.Errorf("%w: test", ErrSenderBlocked))
+	failed := fmt.Errorf("sending via 'Mail' failed: timeout")
+
+	if !IsBlocked(errors.Join(blocked, blocked)) {
+		t.Errorf("Blocked channels not detected")
+	}
+
+	if IsBlocked(errors.Join(blocked, failed)) || IsBlocked(failed) || IsBlocked(nil) {
+		t.Errorf("Failed channel treated as blocked")
+	}
+}
+
+type limitedFlakySender struct {
+	flakySender
+}
+
+func (l *limitedFlakySender) MaxMessageLength() sms.MessageLimit {
+	return sms.MessageLimit{GSM7: 20, UCS2: 10}
+}
+
+// TestRateLimitParts checks that the rate limit is checked once for all parts of a message
+func TestRateLimitParts(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	guard := NewSenderGuard(map[string]RateLimit{"test": {PerMinute: 2}}, 0, 0, nil)
+	guard.now = func() time.Time { return now }
+
+	sender := &limitedFlakySender{flakySender{name: "test"}}
+	pool := NewDeliveryPool(map[string]int{}, DefaultSenderConcurrency, nil)
+	pool.SetGuard(guard)
+
+	channels := []sms.Channel{{AddrType: "SMS", Address: "addr", Sender: sender}}
+	message := "one two three four five six seven eight"
+
+	// Nothing was sent in the last minute, i.e. all three parts are sent although the limit is two
+	_, err := sms.SendWithFallback(context.Background(), channels, message, &sms.MessageInfo{}, pool.Send)
+	if (err != nil) || (sender.sent != 3) {
+		t.Fatalf("Message not sent: %v %d", err, sender.sent)
+	}
+
+	now = now.Add(30 * time.Second)
+
+	// No part is sent if the limit does not allow to send all of them
+	_, err = sms.SendWithFallback(context.Background(), channels, message, &sms.MessageInfo{}, pool.Send)
+	if !IsBlocked(err) || (sender.sent != 3) {
+		t.Errorf("Parts sent despite rate limit: %v %d", err, sender.sent)
+	}
+
+	now = now.Add(time.Minute)
+
+	_, err = sms.SendWithFallback(context.Background(), channels, message, &sms.MessageInfo{}, pool.Send)
+	if (err != nil) || (sender.sent != 6) {
+		t.Errorf("Message not sent after limit expired: %v %d", err, sender.sent)
+	}
+}
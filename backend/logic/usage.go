@@ -0,0 +1,163 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"notifier/repo"
+	"notifier/sms"
+	"notifier/tools"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SenderUsage is the number of segments a sender has sent in a month. Cap is zero if no monthly cap
+// is configured for the sender.
+type SenderUsage struct {
+	Sender   string `json:"sender"`
+	Segments int    `json:"segments"`
+	Cap      int    `json:"cap,omitempty"`
+}
+
+type UsageStatistics struct {
+	Month      string             `json:"month"`
+	Senders    []SenderUsage      `json:"senders"`
+	Recipients []*repo.UsageEntry `json:"recipients"`
+}
+
+// UsageTracker counts the message segments which are sent per recipient and sender in each calendar
+// month. Months are determined in the time zone of the clients. Low priority notifications are no
+// longer sent through a sender which has reached its monthly cap. Like the delivery history the tracker
+// uses its own lock.
+type UsageTracker struct {
+	db        repo.DBSerializer
+	generator func(repo.DbType) repo.UsageRepoWrite
+	caps      map[string]int
+}
+
+func NewUsageTracker(l repo.DBSerializer, g func(repo.DbType) *repo.BoltUsageRepo, caps map[string]int) *UsageTracker {
+	genW := func(db repo.DbType) repo.UsageRepoWrite {
+		return g(db)
+	}
+
+	return &UsageTracker{
+		db:        l,
+		generator: genW,
+		caps:      caps,
+	}
+}
+
+// MonthOf returns the calendar month which contains t in the form YYYY-MM
+func MonthOf(t time.Time) string {
+	return t.In(tools.ClientTZ()).Format("2006-01")
+}
+
+// GetCap returns the monthly cap of the sender. Zero means that there is no cap.
+func (u *UsageTracker) GetCap(senderName string) int {
+	return u.caps[senderName]
+}
+
+// Count adds the number of segments needed for sending the message through the channel to the usage
+// of the current month
+func (u *UsageTracker) Count(channel *sms.Channel, recipient *tools.UUID, message string, now time.Time) error {
+	segments := sms.CountSegments(channel.Sender, message)
+
+	writeRepo := repo.LockAndGetRepoRW(u.db, u.generator)
+	defer func() { u.db.Unlock() }()
+
+	err := writeRepo.Add(MonthOf(now), channel.Sender.GetName(), recipient, segments)
+	if err != nil {
+		return fmt.Errorf("unable to count usage: %v", err)
+	}
+
+	return nil
+}
+
+// CountPartialDelivery adds the parts which were delivered to the usage of the current month if sendErr
+// is a PartialDeliveryError. The rest of the message is counted when it is sent.
+func (u *UsageTracker) CountPartialDelivery(recipient *tools.UUID, sendErr error, now time.Time) error {
+	var partial *sms.PartialDeliveryError
+	if !errors.As(sendErr, &partial) {
+		return nil
+	}
+
+	for _, j := range partial.Delivered {
+		err := u.Count(j.Channel, recipient, j.Message, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetStatistics returns the usage of the given month sorted by sender and recipient
+func (u *UsageTracker) GetStatistics(month string) (*UsageStatistics, error) {
+	u.db.RLock()
+	entries, err := repo.GetRepo(u.db, u.generator).GetMonth(month)
+	u.db.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	totals := map[string]int{}
+	for _, j := range entries {
+		totals[j.Sender] += j.Segments
+	}
+
+	res := &UsageStatistics{
+		Month:      month,
+		Senders:    []SenderUsage{},
+		Recipients: entries,
+	}
+
+	for i, j := range totals {
+		res.Senders = append(res.Senders, SenderUsage{Sender: i, Segments: j, Cap: u.GetCap(i)})
+	}
+
+	slices.SortFunc(res.Senders, func(a, b SenderUsage) int {
+		return strings.Compare(a.Sender, b.Sender)
+	})
+
+	slices.SortStableFunc(res.Recipients, func(a, b *repo.UsageEntry) int {
+		return strings.Compare(a.Sender, b.Sender)
+	})
+
+	return res, nil
+}
+
+// RemoveCappedChannels returns the channels whose senders have not yet reached their monthly cap. The
+// second return value contains the names of the senders which were removed.
+func (u *UsageTracker) RemoveCappedChannels(channels []sms.Channel, now time.Time) ([]sms.Channel, []string, error) {
+	if len(u.caps) == 0 {
+		return channels, []string{}, nil
+	}
+
+	stats, err := u.GetStatistics(MonthOf(now))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	capped := map[string]bool{}
+	for _, j := range stats.Senders {
+		capped[j.Sender] = (j.Cap > 0) && (j.Segments >= j.Cap)
+	}
+
+	res := []sms.Channel{}
+	removed := []string{}
+
+	for _, j := range channels {
+		name := j.Sender.GetName()
+		if capped[name] {
+			if !slices.Contains(removed, name) {
+				removed = append(removed, name)
+			}
+
+			continue
+		}
+
+		res = append(res, j)
+	}
+
+	return res, removed, nil
+}
@@ -0,0 +1,79 @@
+package logic
+
+import (
+	"notifier/repo"
+	"notifier/sms"
+	"notifier/tools"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageTracker(t *testing.T) {
+	tools.SetDefaultTZ()
+
+	db, err := repo.InitDB(filepath.Join(t.TempDir(), "usage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	usage := NewUsageTracker(repo.NewBoltDBLocker(db), repo.NewBBoltUsageRepo, map[string]int{"IFTTT - dummy": 3})
+
+	sms1 := sms.Channel{AddrType: sms.TypeIFTTT, Sender: sms.NewDummySender()}
+	mail := sms.Channel{AddrType: sms.TypeMail, Sender: &slowSender{name: "Mail"}}
+	recipient1 := tools.UUIDGen()
+	recipient2 := tools.UUIDGen()
+	october := time.Date(2026, 10, 19, 12, 0, 0, 0, tools.ClientTZ())
+	november := time.Date(2026, 11, 1, 12, 0, 0, 0, tools.ClientTZ())
+
+	// A message which needs two SMS
+	err = usage.Count(&sms1, recipient1, strings.Repeat("a", 200), october)
+	if err == nil {
+		err = usage.Count(&sms1, recipient2, "test", october)
+	}
+	if err == nil {
+		err = usage.Count(&mail, recipient1, strings.Repeat("a", 200), october)
+	}
+	if err == nil {
+		err = usage.Count(&sms1, recipient1, "test", november)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SMPP splits messages internally. A long UCS-2 message needs three SMS.
+	smpp := sms.Channel{AddrType: sms.TypeSmpp, Sender: sms.NewSmppSender(sms.SmppConfig{})}
+	err = usage.Count(&smpp, recipient1, strings.Repeat("Привет", 25), october)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := usage.GetStatistics(MonthOf(october))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (stats.Month != "2026-10") || (len(stats.Senders) != 3) || (len(stats.Recipients) != 4) {
+		t.Fatalf("Wrong statistics: %v", stats)
+	}
+
+	if (stats.Senders[0] != SenderUsage{Sender: "IFTTT - dummy", Segments: 3, Cap: 3}) || (stats.Senders[1] != SenderUsage{Sender: "Mail", Segments: 1}) || (stats.Senders[2] != SenderUsage{Sender: sms.TypeSmpp, Segments: 3}) {
+		t.Errorf("Wrong sender statistics: %v", stats.Senders)
+	}
+
+	channels, capped, err := usage.RemoveCappedChannels([]sms.Channel{sms1, mail}, october)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (len(channels) != 1) || (channels[0].AddrType != sms.TypeMail) || (len(capped) != 1) {
+		t.Errorf("Capped channel not removed: %v %v", channels, capped)
+	}
+
+	channels, capped, _ = usage.RemoveCappedChannels([]sms.Channel{sms1, mail}, november)
+	if (len(channels) != 2) || (len(capped) != 0) {
+		t.Errorf("Cap of last month applied: %v %v", channels, capped)
+	}
+}
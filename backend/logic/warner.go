@@ -1,42 +1,114 @@
 package logic
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"notifier/repo"
 	"notifier/sms"
 	"notifier/tools"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 const metricsTicks = "ticks"
+const metricsDeadLetter = "dead_letter"
 
 type expiryInfo struct {
-	uuid        *tools.UUID
-	parent      *tools.UUID
-	recipient   *tools.UUID
-	description string
+	uuid                *tools.UUID
+	parent              *tools.UUID
+	recipient           *tools.UUID
+	description         string
+	warningTime         time.Time
+	reminderDescription string
+	reminderKind        repo.ReminderType
+	priority            repo.Priority
+	eventTime           time.Time
+	reminderOptions     map[string]string
+}
+
+func (e *expiryInfo) messageInfo() *sms.MessageInfo {
+	return &sms.MessageInfo{
+		RecipientId:         e.recipient,
+		NotificationId:      e.uuid,
+		ReminderId:          e.parent,
+		ReminderDescription: e.reminderDescription,
+		ReminderKind:        e.reminderKind,
+		Priority:            e.priority,
+		EventTime:           e.eventTime,
+		WarningTime:         e.warningTime,
+		ReminderOptions:     e.reminderOptions,
+	}
 }
 
 type warningGenerator struct {
+	ctx            context.Context
 	db             repo.DBSerializer
 	addrBook       sms.SmsAddressBook
 	ticker         *time.Ticker
 	log            *log.Logger
 	metricCallback tools.AddMetricsEvent
+	pool           *DeliveryPool
+	retryPolicy    *RetryPolicy
+	history        *DeliveryHistory
+	usage          *UsageTracker
+}
+
+type WarnerOption func(*warningGenerator)
+
+// WithDeliveryPool makes the warner use the given pool when sending notifications. If this option
+// is not used each sender is allowed to send DefaultSenderConcurrency messages at the same time.
+func WithDeliveryPool(p *DeliveryPool) WarnerOption {
+	return func(w *warningGenerator) {
+		w.pool = p
+	}
+}
+
+// WithRetryPolicy determines how the warner deals with notifications which could not be delivered
+func WithRetryPolicy(r *RetryPolicy) WarnerOption {
+	return func(w *warningGenerator) {
+		w.retryPolicy = r
+	}
+}
+
+// WithHistory makes the warner record the outcome of each delivery attempt in the given history. The
+// warner also removes old entries from the history.
+func WithHistory(h *DeliveryHistory) WarnerOption {
+	return func(w *warningGenerator) {
+		w.history = h
+	}
+}
+
+// WithUsageTracker makes the warner count the segments which are sent per recipient and sender. Low
+// priority notifications are not sent through senders which have reached their monthly cap.
+func WithUsageTracker(u *UsageTracker) WarnerOption {
+	return func(w *warningGenerator) {
+		w.usage = u
+	}
 }
 
 // StartWarner launches the background warning goroutine and returns a stop
 // function. Calling the stop function signals the goroutine to exit and blocks
 // until any in-flight tick has finished, so the caller can safely close the
 // database afterwards.
-func StartWarner(l repo.DBSerializer, addrBook sms.SmsAddressBook, t *time.Ticker, lg *log.Logger, m tools.AddMetricsEvent) func() {
+func StartWarner(l repo.DBSerializer, addrBook sms.SmsAddressBook, t *time.Ticker, lg *log.Logger, m tools.AddMetricsEvent, options ...WarnerOption) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	warner := warningGenerator{
+		ctx:            ctx,
 		db:             l,
 		addrBook:       addrBook,
 		ticker:         t,
 		log:            lg,
 		metricCallback: m,
+		pool:           NewDeliveryPool(map[string]int{}, DefaultSenderConcurrency, nil),
+		retryPolicy:    NewDefaultRetryPolicy(),
+	}
+
+	for _, o := range options {
+		o(&warner)
 	}
 
 	done := make(chan struct{})
@@ -57,16 +129,23 @@ func StartWarner(l repo.DBSerializer, addrBook sms.SmsAddressBook, t *time.Ticke
 		}
 	}()
 
+	// Stopping the warner aborts all messages which are currently sent. The returned function
+	// can be called more than once.
+	var once sync.Once
+
 	return func() {
-		close(done)
-		<-stopped
-		lg.Println("Warner stopped")
+		once.Do(func() {
+			cancel()
+			close(done)
+			<-stopped
+			lg.Println("Warner stopped")
+		})
 	}
 }
 
 func (w *warningGenerator) collect(refTime time.Time) []expiryInfo {
 	res := []expiryInfo{}
-	readRepo, _ := w.db.RLock()
+	readRepo, reminderRepo := w.db.RLock()
 	defer func() { w.db.RUnlock() }()
 
 	uuids, err := readRepo.GetExpired(refTime)
@@ -85,7 +164,24 @@ func (w *warningGenerator) collect(refTime time.Time) []expiryInfo {
 				parent:      info.Parent,
 				recipient:   info.Recipient,
 				description: info.Description,
+				warningTime: info.WarningTime,
+			}
+
+			reminder, err := reminderRepo.Get(info.Parent)
+			if err != nil {
+				w.log.Printf("Unable to retrieve reminder for notification id '%s'", j)
+			} else if reminder != nil {
+				currentInfo.reminderDescription = reminder.Description
+				currentInfo.eventTime = info.EventTime
+				// Notifications which were created by older versions do not contain the time of the event
+				if currentInfo.eventTime.IsZero() {
+					currentInfo.eventTime = reminder.Spec
+				}
+				currentInfo.reminderKind = reminder.Kind
+				currentInfo.priority = reminder.Priority
+				currentInfo.reminderOptions = reminder.Options
 			}
+
 			res = append(res, currentInfo)
 		}
 	}
@@ -93,13 +189,228 @@ func (w *warningGenerator) collect(refTime time.Time) []expiryInfo {
 	return res
 }
 
-func (w *warningGenerator) sendAndDeleteOne(info expiryInfo) bool {
-	// First obtain lock on Reminder and Notification store and only after
-	// that get a lock on AddressBook. This prevents deadlocks.
+// recordDelivery writes an entry to the delivery history. The channel is the one which was used
+// successfully or, in case of a failure, the primary channel of the recipient. It may be nil. The
+// reason explains why a message was not sent to its original recipient. It may be empty.
+func (w *warningGenerator) recordDelivery(info expiryInfo, channel *sms.Channel, outcome string, deliveryErr error, reason string) {
+	if w.history == nil {
+		return
+	}
+
+	record := repo.DeliveryRecord{
+		NotificationId: info.uuid,
+		ReminderId:     info.parent,
+		Recipient:      info.recipient,
+		Message:        info.description,
+		Outcome:        outcome,
+		Reason:         reason,
+	}
+
+	if channel != nil {
+		record.SenderName = channel.Sender.GetName()
+		record.AddrType = channel.AddrType
+		record.Address = channel.Address
+	}
+
+	if deliveryErr != nil {
+		record.Error = deliveryErr.Error()
+	}
+
+	err := w.history.Record(&record)
+	if err != nil {
+		w.log.Printf("Unable to record delivery of notification '%s': %v", info.uuid, err)
+	}
+}
+
+func (w *warningGenerator) purgeHistory(refTime time.Time) {
+	if w.history == nil {
+		return
+	}
+
+	count, err := w.history.Purge(refTime)
+	if err != nil {
+		w.log.Printf("Unable to remove old entries from delivery history: %v", err)
+		return
+	}
+
+	if count > 0 {
+		w.log.Printf("Removed %d old entries from delivery history", count)
+	}
+}
+
+func (w *warningGenerator) deleteNotification(id *tools.UUID) bool {
 	writeRepo, _ := w.db.Lock()
 	defer func() { w.db.Unlock() }()
 
-	ok, address, err := w.addrBook.CheckRecipient(info.recipient)
+	err := writeRepo.Delete(id)
+	if err != nil {
+		w.log.Printf("Unable to delete notification '%s': %v", id, err)
+		return false
+	}
+
+	return true
+}
+
+// handleFailure schedules a retry of the notification or moves it to the dead letter store. It returns
+// true if the notification was removed from the notification store.
+func (w *warningGenerator) handleFailure(info expiryInfo, primary *sms.Channel, sendErr error, reason string) bool {
+	isDead, err := w.recordFailedAttempt(info, sendErr)
+	if err != nil {
+		w.log.Printf("Unable to record failed delivery of notification '%s': %v", info.uuid, err)
+		w.recordDelivery(info, primary, repo.OutcomeFailed, sendErr, reason)
+		return false
+	}
+
+	if !isDead {
+		w.recordDelivery(info, primary, repo.OutcomeFailed, sendErr, reason)
+		return false
+	}
+
+	w.log.Printf("Giving up on notification '%s'. Moved to dead letters", info.uuid)
+	w.recordDelivery(info, primary, repo.OutcomeDeadLetter, sendErr, reason)
+
+	if w.metricCallback != nil {
+		w.metricCallback(metricsDeadLetter)
+	}
+
+	return true
+}
+
+func (w *warningGenerator) recordFailedAttempt(info expiryInfo, sendErr error) (bool, error) {
+	w.countDelivered(info, sendErr)
+
+	writeRepo, _ := w.db.Lock()
+	defer func() { w.db.Unlock() }()
+
+	deadRepo := repo.GetRepo(w.db, repo.NewBBoltDeadLetterRepo)
+
+	return RecordFailedAttempt(writeRepo, deadRepo, w.retryPolicy, info.uuid, sendErr, time.Now())
+}
+
+func (w *warningGenerator) recordPartialDelivery(info expiryInfo, sendErr error) {
+	w.countDelivered(info, sendErr)
+
+	writeRepo, _ := w.db.Lock()
+	defer func() { w.db.Unlock() }()
+
+	err := RecordPartialDelivery(writeRepo, info.uuid, sendErr)
+	if err != nil {
+		w.log.Printf("Unable to update notification '%s': %v", info.uuid, err)
+	}
+}
+
+func (w *warningGenerator) deferNotification(info expiryInfo, until time.Time) bool {
+	writeRepo, _ := w.db.Lock()
+	defer func() { w.db.Unlock() }()
+
+	_, err := DeferNotification(writeRepo, info.uuid, until)
+	if err != nil {
+		w.log.Printf("Unable to defer notification '%s': %v", info.uuid, err)
+		return false
+	}
+
+	return true
+}
+
+// applyAbsence handles notifications for absent recipients. If the notification was suppressed or
+// deferred the first return value is true and the second one tells whether the notification was removed
+// from the notification store. In case of a redirection the channels of the substitute are returned
+// together with the reason for the redirection.
+func (w *warningGenerator) applyAbsence(info expiryInfo, absence *repo.Absence) (bool, bool, []sms.Channel, string) {
+	until := absence.End.In(tools.ClientTZ()).Format(time.DateTime)
+
+	switch absence.Policy {
+	case repo.AbsenceSuppress:
+		reason := fmt.Sprintf("recipient is absent until %s", until)
+		w.log.Printf("Recipient '%s' is absent. Suppressing notification '%s'", info.recipient, info.uuid)
+		w.recordDelivery(info, nil, repo.OutcomeSuppressed, nil, reason)
+		return true, w.deleteNotification(info.uuid), nil, ""
+	case repo.AbsenceDefer:
+		if w.deferNotification(info, absence.End) {
+			reason := fmt.Sprintf("recipient is absent, deferred until %s", until)
+			w.log.Printf("Recipient '%s' is absent. Deferring notification '%s'", info.recipient, info.uuid)
+			w.recordDelivery(info, nil, repo.OutcomeDeferred, nil, reason)
+		}
+		return true, false, nil, ""
+	case repo.AbsenceRedirect:
+		if absence.Substitute == nil {
+			break
+		}
+
+		// Absences of the substitute are not taken into account. Otherwise redirections could loop.
+		ok, channels, err := w.addrBook.CheckRecipient(absence.Substitute)
+		if err != nil || !ok {
+			w.log.Printf("Substitute '%s' of recipient '%s' is invalid. Sending to original recipient", absence.Substitute, info.recipient)
+			break
+		}
+
+		return false, false, channels, fmt.Sprintf("recipient is absent until %s, redirected to '%s'", until, absence.Substitute)
+	}
+
+	return false, false, nil, ""
+}
+
+// applyCaps removes the channels whose senders have reached their monthly cap from the channels of
+// a low priority notification. If no channel remains the notification is suppressed. In this case the
+// first return value is true and the second one tells whether the notification was removed from the
+// notification store. Otherwise the remaining channels are returned together with the reason for
+// the removal of channels.
+func (w *warningGenerator) applyCaps(info expiryInfo, channels []sms.Channel) (bool, bool, []sms.Channel, string) {
+	if (w.usage == nil) || (info.priority > repo.PriorityLow) {
+		return false, false, channels, ""
+	}
+
+	available, capped, err := w.usage.RemoveCappedChannels(channels, time.Now())
+	if err != nil {
+		w.log.Printf("Unable to check monthly caps for notification '%s': %v", info.uuid, err)
+		return false, false, channels, ""
+	}
+
+	if len(capped) == 0 {
+		return false, false, channels, ""
+	}
+
+	reason := fmt.Sprintf("monthly cap of '%s' reached", strings.Join(capped, "', '"))
+
+	if len(available) == 0 {
+		w.log.Printf("Suppressing low priority notification '%s' for '%s': %s", info.uuid, info.recipient, reason)
+		w.recordDelivery(info, nil, repo.OutcomeSuppressed, nil, reason)
+		return true, w.deleteNotification(info.uuid), nil, ""
+	}
+
+	w.log.Printf("Using fallback channels for low priority notification '%s': %s", info.uuid, reason)
+
+	return false, false, available, reason
+}
+
+func (w *warningGenerator) countUsage(info expiryInfo, channel *sms.Channel) {
+	if w.usage == nil {
+		return
+	}
+
+	err := w.usage.Count(channel, info.recipient, info.description, time.Now())
+	if err != nil {
+		w.log.Printf("Unable to count usage of notification '%s': %v", info.uuid, err)
+	}
+}
+
+// countDelivered adds the parts of a partially delivered message to the usage
+func (w *warningGenerator) countDelivered(info expiryInfo, sendErr error) {
+	if w.usage == nil {
+		return
+	}
+
+	err := w.usage.CountPartialDelivery(info.recipient, sendErr, time.Now())
+	if err != nil {
+		w.log.Printf("Unable to count usage of notification '%s': %v", info.uuid, err)
+	}
+}
+
+// sendAndDeleteOne does not hold the lock on the Reminder and Notification store while the message
+// is sent. Otherwise the delivery of all notifications would be serialized by this lock. The address
+// book lock is only held while CheckRecipient is executed.
+func (w *warningGenerator) sendAndDeleteOne(info expiryInfo) bool {
+	ok, channels, err := w.addrBook.CheckRecipient(info.recipient)
 	if err != nil {
 		w.log.Printf("Unable to determine validity of recipient '%s': %v", info.recipient, err)
 		return false
@@ -107,34 +418,80 @@ func (w *warningGenerator) sendAndDeleteOne(info expiryInfo) bool {
 
 	if !ok {
 		w.log.Printf("Recipient '%s' in notification '%s' is invalid. Deleting notification", info.recipient, info.uuid)
-		err = writeRepo.Delete(info.uuid)
-		if err != nil {
-			w.log.Printf("Unable to delete notification '%s': %v", info.uuid, err)
-			return false
+		w.recordDelivery(info, nil, repo.OutcomeDiscarded, fmt.Errorf("recipient is unknown"), "")
+		return w.deleteNotification(info.uuid)
+	}
+
+	absence, err := w.addrBook.GetAbsence(info.recipient, time.Now())
+	if err != nil {
+		w.log.Printf("Unable to determine absence of recipient '%s': %v", info.recipient, err)
+		return false
+	}
+
+	outcome := repo.OutcomeSent
+	reason := ""
+
+	if absence != nil {
+		handled, removed, substituteChannels, redirectReason := w.applyAbsence(info, absence)
+		if handled {
+			return removed
+		}
+
+		if substituteChannels != nil {
+			channels = substituteChannels
+			outcome = repo.OutcomeRedirected
+			reason = redirectReason
 		}
-		return true
 	}
 
-	sender := w.addrBook.GetSender(info.recipient)
+	handled, removed, channels, capReason := w.applyCaps(info, channels)
+	if handled {
+		return removed
+	}
+
+	if capReason != "" {
+		reason = strings.TrimPrefix(reason+", "+capReason, ", ")
+	}
+
+	channel, err := sms.SendWithFallback(w.ctx, channels, info.description, info.messageInfo(), w.pool.Send)
+	if (err != nil) && (w.ctx.Err() != nil) {
+		// The warner is stopping. This is not the fault of the recipient's channels, i.e. the
+		// notification is sent again after the next start without counting a failed attempt.
+		w.log.Printf("Sending notification '%s' aborted: %v", info.uuid, err)
+		w.recordPartialDelivery(info, err)
+		return false
+	}
+
+	if IsBlocked(err) {
+		// No channel is usable at the moment due to rate limits or open circuit breakers. This is
+		// not counted as a failed attempt, i.e. the notification is sent with one of the next ticks.
+		w.log.Printf("Notification '%s' remains queued: %v", info.uuid, err)
+		return false
+	}
 
-	err = sender.Send(address, info.description)
 	if err != nil {
 		w.log.Printf("Unable to send SMS to '%s' for notification '%s': %v", info.recipient, info.uuid, err)
-		w.metricCallback(fmt.Sprintf("fail:%s:%s", address, info.recipient.String()))
-		return false
+
+		var primary *sms.Channel = nil
+		if len(channels) > 0 {
+			primary = &channels[0]
+			w.metricCallback(fmt.Sprintf("fail:%s:%s", primary.Address, info.recipient.String()))
+		}
+
+		return w.handleFailure(info, primary, err, reason)
 	}
 
-	w.log.Printf("Message sent to '%s' for notification '%s'", info.recipient, info.uuid)
+	w.log.Printf("Message sent to '%s' via '%s' for notification '%s'", info.recipient, channel.AddrType, info.uuid)
+	w.recordDelivery(info, channel, outcome, nil, reason)
+	w.countUsage(info, channel)
 
 	if w.metricCallback != nil {
 		w.metricCallback(tools.NotificationSent)
-		w.metricCallback(fmt.Sprintf("%s:%s", address, info.recipient.String()))
-		w.metricCallback(sender.GetName())
+		w.metricCallback(fmt.Sprintf("%s:%s", channel.Address, info.recipient.String()))
+		w.metricCallback(channel.Sender.GetName())
 	}
 
-	err = writeRepo.Delete(info.uuid)
-	if err != nil {
-		w.log.Printf("Unable to delete notification '%s': %v", info.uuid, err)
+	if !w.deleteNotification(info.uuid) {
 		return false
 	}
 
@@ -143,6 +500,68 @@ func (w *warningGenerator) sendAndDeleteOne(info expiryInfo) bool {
 	return true
 }
 
+// groupByRecipient returns the expired notifications grouped by recipient. Inside each group the
+// notifications are sorted by their warning time.
+func groupByRecipient(expired []expiryInfo) [][]expiryInfo {
+	groups := map[string][]expiryInfo{}
+	order := []string{}
+
+	for _, j := range expired {
+		key := j.recipient.String()
+		_, ok := groups[key]
+		if !ok {
+			order = append(order, key)
+		}
+
+		groups[key] = append(groups[key], j)
+	}
+
+	res := [][]expiryInfo{}
+
+	for _, j := range order {
+		group := groups[j]
+		slices.SortStableFunc(group, func(a, b expiryInfo) int {
+			return a.warningTime.Compare(b.warningTime)
+		})
+		res = append(res, group)
+	}
+
+	return res
+}
+
+// deliver sends all expired notifications. Notifications for different recipients are delivered
+// in parallel, where the delivery pool limits the number of concurrent sends per sender. The
+// notifications for one recipient are sent one after the other in order to preserve their ordering.
+func (w *warningGenerator) deliver(expired []expiryInfo) map[string]bool {
+	affectedParents := map[string]bool{}
+	mutex := new(sync.Mutex)
+	var wg sync.WaitGroup
+
+	for _, group := range groupByRecipient(expired) {
+		wg.Add(1)
+
+		go func(g []expiryInfo) {
+			defer wg.Done()
+
+			for _, j := range g {
+				if w.ctx.Err() != nil {
+					return
+				}
+
+				if w.sendAndDeleteOne(j) {
+					mutex.Lock()
+					affectedParents[j.parent.String()] = true
+					mutex.Unlock()
+				}
+			}
+		}(group)
+	}
+
+	wg.Wait()
+
+	return affectedParents
+}
+
 func (w *warningGenerator) determineChildlessParents(affectedParents map[string]bool) []string {
 	res := []string{}
 
@@ -167,15 +586,10 @@ func (w *warningGenerator) determineChildlessParents(affectedParents map[string]
 
 func (w *warningGenerator) processTick(refTime time.Time) {
 	w.log.Printf("Ticking at %v", refTime)
-	affectedParents := map[string]bool{}
+	w.purgeHistory(refTime)
 
 	expiredNotifications := w.collect(refTime)
-
-	for _, j := range expiredNotifications {
-		if w.sendAndDeleteOne(j) {
-			affectedParents[j.parent.String()] = true
-		}
-	}
+	affectedParents := w.deliver(expiredNotifications)
 
 	// Prevent locking of database if there is nothing to do
 	if len(affectedParents) == 0 {
@@ -183,5 +597,5 @@ func (w *warningGenerator) processTick(refTime time.Time) {
 	}
 
 	remindersToReschedule := w.determineChildlessParents(affectedParents)
-	ProcessExpired(w.db, w.log, remindersToReschedule)
+	ProcessExpired(w.db, w.log, remindersToReschedule, w.addrBook.ExpandRecipients)
 }
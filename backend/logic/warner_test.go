@@ -0,0 +1,334 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"log"
+	"notifier/repo"
+	"notifier/sms"
+	"notifier/tools"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type warnerTest struct {
+	db             *bolt.DB
+	dbl            repo.DBSerializer
+	warner         *warningGenerator
+	buffer         *sms.CaptureBuffer
+	notificationId *tools.UUID
+	recipientId    *tools.UUID
+	now            time.Time
+}
+
+// newWarnerTest creates a warner whose messages are captured in a sandbox. There is one expired
+// notification of a reminder with the given priority. The recipient can be reached via mail and IFTTT.
+func newWarnerTest(t *testing.T, priority repo.Priority) *warnerTest {
+	db, err := repo.InitDB(filepath.Join(t.TempDir(), "warner.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	res := &warnerTest{
+		db:             db,
+		dbl:            repo.NewBoltDBLocker(db),
+		notificationId: tools.UUIDGen(),
+		recipientId:    tools.UUIDGen(),
+		now:            time.Now().UTC(),
+	}
+
+	dblAddr := repo.NewBoltDBLocker(db)
+	recipientId := res.recipientId
+	reminderId := tools.UUIDGen()
+
+	err = repo.NewBBoltAddressBookRepo(db).Upsert(&repo.Recipient{
+		DisplayName: "Test",
+		Id:          recipientId,
+		Address:     "test@example.org",
+		AddrType:    sms.TypeMail,
+		Fallbacks:   []repo.RecipientChannel{{Address: "0123", AddrType: sms.TypeIFTTT}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nRepo, rRepo := res.dbl.Lock()
+	err = rRepo.Upsert(&repo.Reminder{
+		Id:          reminderId,
+		Kind:        repo.OneShot,
+		WarningAt:   []repo.WarningType{repo.SameDay},
+		Spec:        res.now.Add(-time.Hour),
+		Description: "Dentist",
+		Recipients:  []*tools.UUID{recipientId},
+		Priority:    priority,
+	})
+	if err == nil {
+		err = nRepo.Upsert(&repo.Notification{
+			Id:          res.notificationId,
+			Parent:      reminderId,
+			WarningTime: res.now.Add(-time.Minute),
+			Description: "Dentist today",
+			Recipient:   recipientId,
+		})
+	}
+	res.dbl.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrBook := sms.NewDBAddressBook(dblAddr, repo.NewBBoltAddressBookRepo)
+	addrBook.AddSender(sms.TypeMail, &slowSender{name: "Mail"})
+	addrBook.AddSender(sms.TypeIFTTT, sms.NewDummySender())
+
+	res.buffer = sms.NewCaptureBuffer(10)
+	sms.EnableSandbox(addrBook, res.buffer)
+
+	res.warner = &warningGenerator{
+		ctx:            context.Background(),
+		db:             res.dbl,
+		addrBook:       addrBook,
+		log:            log.New(os.Stdout, "", log.LstdFlags),
+		metricCallback: func(string) {},
+		pool:           NewDeliveryPool(map[string]int{}, DefaultSenderConcurrency, nil),
+		retryPolicy:    NewDefaultRetryPolicy(),
+	}
+
+	return res
+}
+
+func (w *warnerTest) isQueued(t *testing.T) bool {
+	readRepo, _ := w.dbl.RLock()
+	defer w.dbl.RUnlock()
+
+	n, err := readRepo.Get(w.notificationId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n != nil
+}
+
+// TestWarnerSandbox sends an expired notification through the warner and checks that the message
+// was captured by the sandbox
+func TestWarnerSandbox(t *testing.T) {
+	test := newWarnerTest(t, repo.PriorityHigh)
+	test.warner.processTick(test.now)
+
+	captured := test.buffer.GetAll()
+	if len(captured) != 1 {
+		t.Fatalf("Expected one captured message, got %d", len(captured))
+	}
+
+	m := captured[0]
+	if (m.AddrType != sms.TypeMail) || (m.Address != "test@example.org") || (m.Message != "Dentist today") {
+		t.Errorf("Wrong message captured: %v", m)
+	}
+
+	if (m.ReminderDescription != "Dentist") || (m.Priority != repo.PriorityHigh) || !m.NotificationId.IsEqual(test.notificationId) {
+		t.Errorf("Wrong message info captured: %v", m)
+	}
+
+	if test.isQueued(t) {
+		t.Errorf("Notification was not deleted")
+	}
+}
+
+func TestWarnerAbsence(t *testing.T) {
+	tools.SetDefaultTZ()
+
+	cases := []struct {
+		policy       string
+		expectedType string
+		queued       bool
+	}{
+		{repo.AbsenceSuppress, "", false},
+		{repo.AbsenceDefer, "", true},
+		{repo.AbsenceRedirect, sms.TypeIFTTT, false},
+	}
+
+	for _, j := range cases {
+		test := newWarnerTest(t, repo.PriorityNormal)
+		addrRepo := repo.NewBBoltAddressBookRepo(test.db)
+		end := test.now.Add(time.Hour)
+
+		substituteId := tools.UUIDGen()
+		err := addrRepo.Upsert(&repo.Recipient{
+			DisplayName: "Substitute",
+			Id:          substituteId,
+			Address:     "4567",
+			AddrType:    sms.TypeIFTTT,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recipient, err := addrRepo.Get(test.recipientId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recipient.Absences = []repo.Absence{{Start: test.now.Add(-time.Hour), End: end, Policy: j.policy}}
+		if j.policy == repo.AbsenceRedirect {
+			recipient.Absences[0].Substitute = substituteId
+		}
+
+		err = addrRepo.Upsert(recipient)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test.warner.processTick(test.now)
+
+		captured := test.buffer.GetAll()
+
+		if j.expectedType == "" {
+			if len(captured) != 0 {
+				t.Errorf("Message sent to absent recipient with policy '%s': %v", j.policy, captured)
+			}
+		} else if (len(captured) != 1) || (captured[0].AddrType != j.expectedType) || (captured[0].Address != "4567") {
+			t.Errorf("Message not redirected to substitute: %v", captured)
+		}
+
+		if test.isQueued(t) != j.queued {
+			t.Errorf("Wrong state of notification with policy '%s'", j.policy)
+		}
+
+		if !j.queued {
+			continue
+		}
+
+		readRepo, _ := test.dbl.RLock()
+		n, _ := readRepo.Get(test.notificationId)
+		test.dbl.RUnlock()
+
+		if !n.NextAttempt.Equal(end) || (n.Attempts != 0) {
+			t.Errorf("Notification not deferred until end of absence: %v", n)
+		}
+	}
+}
+
+func TestWarnerMonthlyCaps(t *testing.T) {
+	tools.SetDefaultTZ()
+
+	cases := []struct {
+		priority     repo.Priority
+		caps         map[string]int
+		expectedType string
+	}{
+		{repo.PriorityNormal, map[string]int{"Mail": 1}, sms.TypeMail},
+		// Uses the fallback channel
+		{repo.PriorityLow, map[string]int{"Mail": 1}, sms.TypeIFTTT},
+		// Suppressed
+		{repo.PriorityLow, map[string]int{"Mail": 1, "IFTTT - dummy": 1}, ""},
+	}
+
+	for _, j := range cases {
+		test := newWarnerTest(t, j.priority)
+		test.warner.usage = NewUsageTracker(repo.NewBoltDBLocker(test.db), repo.NewBBoltUsageRepo, j.caps)
+
+		for i := range j.caps {
+			err := test.warner.usage.Count(&sms.Channel{Sender: &slowSender{name: i}}, nil, "test", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		test.warner.processTick(test.now)
+
+		captured := test.buffer.GetAll()
+
+		if j.expectedType == "" {
+			if len(captured) != 0 {
+				t.Errorf("Notification not suppressed: %v", captured)
+			}
+		} else if (len(captured) != 1) || (captured[0].AddrType != j.expectedType) {
+			t.Errorf("Wrong channel used for priority %d: %v", j.priority, captured)
+		}
+
+		if test.isQueued(t) {
+			t.Errorf("Notification was not removed")
+		}
+	}
+}
+
+// partialSender only delivers the beginning of the first message. All other messages fail.
+type partialSender struct {
+	name      string
+	remaining string
+	calls     int
+}
+
+func (p *partialSender) GetName() string {
+	return p.name
+}
+
+func (p *partialSender) Send(ctx context.Context, recipientAddress string, message string, info *sms.MessageInfo) error {
+	p.calls++
+	if (p.calls > 1) || (p.remaining == "") {
+		return errors.New("unavailable")
+	}
+
+	return &sms.PartialDeliveryError{Remaining: p.remaining, Err: errors.New("connection lost")}
+}
+
+// TestWarnerPartialDeliveryUsage checks that the delivered beginning of a message is counted although
+// the notification failed
+func TestWarnerPartialDeliveryUsage(t *testing.T) {
+	tools.SetDefaultTZ()
+
+	test := newWarnerTest(t, repo.PriorityNormal)
+	test.warner.usage = NewUsageTracker(repo.NewBoltDBLocker(test.db), repo.NewBBoltUsageRepo, map[string]int{})
+	test.warner.addrBook.AddSender(sms.TypeMail, &partialSender{name: "Mail", remaining: "today"})
+	test.warner.addrBook.AddSender(sms.TypeIFTTT, &partialSender{name: "IFTTT"})
+
+	test.warner.processTick(test.now)
+
+	readRepo, _ := test.dbl.RLock()
+	n, _ := readRepo.Get(test.notificationId)
+	test.dbl.RUnlock()
+
+	if (n == nil) || (n.Attempts != 1) || (n.Description != sms.ContinuationPrefix+"today") {
+		t.Fatalf("Partial delivery not recorded: %v", n)
+	}
+
+	stats, err := test.warner.usage.GetStatistics(MonthOf(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (len(stats.Senders) != 1) || (stats.Senders[0] != SenderUsage{Sender: "Mail", Segments: 1}) {
+		t.Errorf("Delivered part not counted: %v", stats.Senders)
+	}
+}
+
+func TestWarnerBlockedSender(t *testing.T) {
+	test := newWarnerTest(t, repo.PriorityNormal)
+
+	guard := NewSenderGuard(map[string]RateLimit{"Mail": {PerDay: 1}, "IFTTT - dummy": {PerDay: 1}}, 0, 0, nil)
+	test.warner.pool.SetGuard(guard)
+
+	for _, j := range []string{"Mail", "IFTTT - dummy"} {
+		if guard.Admit(context.Background(), &slowSender{name: j}, nil, 1) != nil {
+			t.Fatal("Admission failed")
+		}
+	}
+
+	test.warner.processTick(test.now)
+
+	if len(test.buffer.GetAll()) != 0 {
+		t.Errorf("Message sent although all senders are blocked")
+	}
+
+	readRepo, _ := test.dbl.RLock()
+	n, _ := readRepo.Get(test.notificationId)
+	test.dbl.RUnlock()
+
+	if (n == nil) || (n.Attempts != 0) {
+		t.Errorf("Blocked notification not queued or counted as failure: %v", n)
+	}
+}
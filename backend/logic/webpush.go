@@ -0,0 +1,65 @@
+package logic
+
+import (
+	"notifier/repo"
+	"notifier/sms"
+	"notifier/tools"
+)
+
+// RemoveWebPushSubscription removes a push subscription which is no longer valid from the recipient
+// with the given id. If the subscription is the primary address of the recipient the whole address book
+// entry is deleted. If it is used as a fallback channel only this channel is removed. The first return
+// value is true if anything was changed.
+func RemoveWebPushSubscription(nWriteRepo repo.NotificationRepoWrite, writeRepo repo.ReminderRepoWrite, addrBookWriteRepo repo.AddrBookWrite, recipientId *tools.UUID, address string) (bool, error) {
+	recipient, err := addrBookWriteRepo.Get(recipientId)
+	if err != nil {
+		return false, err
+	}
+
+	if recipient == nil {
+		return false, nil
+	}
+
+	if (recipient.AddrType == sms.TypeWebPush) && (recipient.Address == address) {
+		err = DeleteAddrBookEntry(nWriteRepo, writeRepo, addrBookWriteRepo, recipientId)
+		return err == nil, err
+	}
+
+	fallbacks := []repo.RecipientChannel{}
+	for _, j := range recipient.Fallbacks {
+		if (j.AddrType != sms.TypeWebPush) || (j.Address != address) {
+			fallbacks = append(fallbacks, j)
+		}
+	}
+
+	if len(fallbacks) == len(recipient.Fallbacks) {
+		return false, nil
+	}
+
+	recipient.Fallbacks = fallbacks
+
+	return true, addrBookWriteRepo.Upsert(recipient)
+}
+
+// FindWebPushSubscription returns the recipient whose primary address is a push subscription with the
+// given endpoint or nil if there is none
+func FindWebPushSubscription(addrBookRead repo.AddrBookRead, endpoint string) (*repo.Recipient, error) {
+	found, err := addrBookRead.Filter(func(r *repo.Recipient) bool {
+		if r.AddrType != sms.TypeWebPush {
+			return false
+		}
+
+		sub, err := sms.ParseWebPushSubscription(r.Address)
+
+		return (err == nil) && (sub.Endpoint == endpoint)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(found) == 0 {
+		return nil, nil
+	}
+
+	return found[0], nil
+}
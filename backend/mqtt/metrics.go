@@ -1,6 +1,7 @@
 package mqtt
 
 import (
+	"context"
 	"notifier/tools"
 	"time"
 )
@@ -26,7 +27,7 @@ func NewMetricsWrapper(s MqttSender, t string) *MqttMetricsWrapper {
 
 func (m *MqttMetricsWrapper) Wrapper(eventId string, cb tools.AddMetricsEvent) {
 	go func(eventId string) {
-		_ = m.sender.PublishWhenConnected(m.topic, []byte(eventId), m.qOs, m.timeOut)
+		_ = m.sender.PublishWhenConnected(context.Background(), m.topic, []byte(eventId), m.qOs, false, m.timeOut)
 	}(eventId)
 
 	cb(eventId)
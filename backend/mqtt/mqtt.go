@@ -95,7 +95,8 @@ var ErrInvalidTimeoutValue = errors.New("a timeout of zero makes no sense")
 var ErrNotConnected = errors.New("connection to message broker currently unavailable")
 
 type MqttSender interface {
-	PublishWhenConnected(topic string, payload []byte, qos byte, timeout time.Duration) error
+	IsConnected() bool
+	PublishWhenConnected(ctx context.Context, topic string, payload []byte, qos byte, retain bool, timeout time.Duration) error
 }
 
 func getTlsConfig(rootFileName string) (*tls.Config, error) {
@@ -281,21 +282,25 @@ func (m *Sender) Stop() {
 	m.cancel()
 }
 
-// PublishWhenConnected sends payload to topic with the given QoS. The publish is
-// bound to a context derived from the sender's root context and the given
-// timeout, so it is cancelled either when the timeout elapses or when the sender
-// is stopped. It returns ErrNotConnected if the broker connection is currently
-// down.
-func (m *Sender) PublishWhenConnected(topic string, payload []byte, qos byte, timeout time.Duration) error {
+// PublishWhenConnected sends payload to topic with the given QoS. If retain is set the
+// broker keeps the message and delivers it to future subscribers of the topic. The publish is
+// bound to a context derived from ctx and the given timeout, so it is cancelled when ctx is
+// done, when the timeout elapses or when the sender is stopped. It returns ErrNotConnected
+// if the broker connection is currently down.
+func (m *Sender) PublishWhenConnected(ctx context.Context, topic string, payload []byte, qos byte, retain bool, timeout time.Duration) error {
 	if !m.IsConnected() {
 		return ErrNotConnected
 	}
 
-	ctx, cancel := context.WithTimeout(m.rootCtx, timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	stop := context.AfterFunc(m.rootCtx, cancel)
+	defer stop()
+
 	_, err := m.PublishWithCtx(ctx, &paho.Publish{
 		QoS:     qos,
+		Retain:  retain,
 		Topic:   topic,
 		Payload: payload,
 	})
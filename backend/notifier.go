@@ -14,6 +14,7 @@ import (
 	"notifier/sms"
 	"notifier/tools"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"time"
@@ -35,6 +36,20 @@ const envExpectedTokenIssuer = "EXPECTED_TOKEN_ISSUER"
 const envExpectedTokenAudience = "EXPECTED_TOKEN_AUDIENCE"
 const envExpectedTokenTtl = "TOKEN_TTL"
 const envExcludeDummySender = "MN_EXCLUDE_DUMMY_SENDER"
+const envSenderConcurrency = "MN_SENDER_CONCURRENCY"
+const envSendTimeout = "MN_SEND_TIMEOUT"
+const envSenderTimeouts = "MN_SENDER_TIMEOUTS"
+const envSenderProbe = "MN_SENDER_PROBE"
+const envMaxSendAttempts = "MN_MAX_SEND_ATTEMPTS"
+const envRetryBaseDelay = "MN_RETRY_BASE_DELAY"
+const envRetryMaxDelay = "MN_RETRY_MAX_DELAY"
+const envHistoryRetention = "MN_HISTORY_RETENTION_DAYS"
+const envSenderRateLimits = "MN_SENDER_RATE_LIMITS"
+const envBreakerThreshold = "MN_BREAKER_THRESHOLD"
+const envBreakerCooldown = "MN_BREAKER_COOLDOWN"
+const envMonthlyCaps = "MN_MONTHLY_CAPS"
+const envSandbox = "MN_SANDBOX"
+const envSandboxSize = "MN_SANDBOX_SIZE"
 const authHeaderName = "X-Token"
 const ERROR_EXIT = 42
 const ERROR_OK = 0
@@ -62,8 +77,11 @@ func saveEnvirnomentInDB(addrSaver *sms.AddressSaver, dbl repo.DBSerializer, gen
 	log.Println("Saved address book from environment to database")
 }
 
-func createAddressBook(dbl repo.DBSerializer, generator func(repo.DbType) *repo.BBoltAddrBookRepo, mqttSender mqtt.MqttSender) sms.SmsAddressBook {
+// createAddressBook returns the address book and a function which closes the connections of the senders.
+// It has to be called after all messages have been sent.
+func createAddressBook(dbl repo.DBSerializer, generator func(repo.DbType) *repo.BBoltAddrBookRepo, mqttSender mqtt.MqttSender, webPushSender *sms.WebPushSender) (sms.SmsAddressBook, tools.NotifierCancelFunc) {
 	var addrBook sms.SmsAddressBook
+	closeSenders := func() {}
 	var addressSaver *sms.AddressSaver
 	var addrBookJsonByte []byte
 	var addrBookJson string
@@ -130,6 +148,79 @@ func createAddressBook(dbl repo.DBSerializer, generator func(repo.DbType) *repo.
 		log.Printf("Local notifier not added: %v", err)
 	}
 
+	ntfySender, err := sms.NewNtfySenderFromEnvironment()
+	if err == nil {
+		addrBook.AddSender(sms.TypeNtfy, ntfySender)
+		log.Println("ntfy notifier added")
+	} else {
+		log.Printf("ntfy notifier not added: %v", err)
+	}
+
+	gotifySender, err := sms.NewGotifySenderFromEnvironment()
+	if err == nil {
+		addrBook.AddSender(sms.TypeGotify, gotifySender)
+		log.Println("Gotify notifier added")
+	} else {
+		log.Printf("Gotify notifier not added: %v", err)
+	}
+
+	telegramSender, err := sms.NewTelegramSenderFromEnvironment()
+	if err == nil {
+		addrBook.AddSender(sms.TypeTelegram, telegramSender)
+		log.Println("Telegram notifier added")
+	} else {
+		log.Printf("Telegram notifier not added: %v", err)
+	}
+
+	matrixSender, err := sms.NewMatrixSenderFromEnvironment()
+	if err == nil {
+		addrBook.AddSender(sms.TypeMatrix, matrixSender)
+		log.Println("Matrix notifier added")
+	} else {
+		log.Printf("Matrix notifier not added: %v", err)
+	}
+
+	signalSender, err := sms.NewSignalSenderFromEnvironment()
+	if err == nil {
+		addrBook.AddSender(sms.TypeSignal, signalSender)
+		log.Println("Signal notifier added")
+	} else {
+		log.Printf("Signal notifier not added: %v", err)
+	}
+
+	pushoverSender, err := sms.NewPushoverSenderFromEnvironment()
+	if err == nil {
+		addrBook.AddSender(sms.TypePushover, pushoverSender)
+		log.Println("Pushover notifier added")
+	} else {
+		log.Printf("Pushover notifier not added: %v", err)
+	}
+
+	smppSender, err := sms.NewSmppSenderFromEnvironment()
+	if err == nil {
+		addrBook.AddSender(sms.TypeSmpp, smppSender)
+		closeSenders = func() {
+			log.Println("SMPP session closing")
+			smppSender.Close()
+		}
+		log.Println("SMPP notifier added")
+	} else {
+		log.Printf("SMPP notifier not added: %v", err)
+	}
+
+	commandSender, err := sms.NewCommandSenderFromEnvironment()
+	if err == nil {
+		addrBook.AddSender(sms.TypeCommand, commandSender)
+		log.Printf("Command notifier added. Using '%s'", commandSender.Path)
+	} else {
+		log.Printf("Command notifier not added: %v", err)
+	}
+
+	if webPushSender != nil {
+		addrBook.AddSender(sms.TypeWebPush, webPushSender)
+		log.Println("Web Push notifier added")
+	}
+
 	if mqttSender != nil {
 		mqttSender := sms.NewMqttMessageSender(mqttSender, MqttMessageSendTimeoutInMs*time.Millisecond)
 		qOsByteStr, ok := os.LookupEnv(sms.EnvMqttqOs)
@@ -147,7 +238,56 @@ func createAddressBook(dbl repo.DBSerializer, generator func(repo.DbType) *repo.
 		log.Println("MQTT notifier not added")
 	}
 
-	return addrBook
+	webhookSenders, err := sms.NewWebhookSendersFromEnvironment()
+	if err == nil {
+		for _, j := range webhookSenders {
+			if slices.Contains(addrBook.GetAllAddressTypes(), j.GetName()) {
+				log.Printf("Webhook '%s' not added: address type already in use", j.GetName())
+				continue
+			}
+
+			addrBook.AddSender(j.GetName(), j)
+			log.Printf("Webhook notifier '%s' added", j.GetName())
+		}
+	} else {
+		log.Printf("Webhook notifiers not added: %v", err)
+	}
+
+	return addrBook, closeSenders
+}
+
+// createWebPushSender returns nil if Web Push is not configured. Subscriptions which are reported as gone
+// by the push service are removed from the address book.
+func createWebPushSender(dbl repo.DBSerializer, dblAddr repo.DBSerializer, generator func(repo.DbType) *repo.BBoltAddrBookRepo) *sms.WebPushSender {
+	webPushSender, err := sms.NewWebPushSenderFromEnvironment()
+	if err != nil {
+		log.Printf("Web Push notifier not added: %v", err)
+		return nil
+	}
+
+	webPushSender.SubscriptionGone = func(recipientId *tools.UUID, address string) {
+		// The sender may be called while the caller holds locks on the database. Therefore the
+		// subscription is removed asynchronously.
+		go func() {
+			nWrite, remWrite := dbl.Lock()
+			defer dbl.Unlock()
+
+			addrWrite := repo.LockAndGetRepoRW(dblAddr, generator)
+			defer func() { dblAddr.Unlock() }()
+
+			changed, err := logic.RemoveWebPushSubscription(nWrite, remWrite, addrWrite, recipientId, address)
+			if err != nil {
+				log.Printf("Unable to remove push subscription of recipient %s: %v", recipientId, err)
+				return
+			}
+
+			if changed {
+				log.Printf("Removed expired push subscription of recipient %s", recipientId)
+			}
+		}()
+	}
+
+	return webPushSender
 }
 
 func getTokenDefinitionsFromEnv() {
@@ -226,6 +366,231 @@ func completeMqttSetup(sender *mqtt.Sender, metricsCallback tools.AddMetricsEven
 	return metricsCallback
 }
 
+func createSendTimeouts() *sms.SendTimeouts {
+	defaultTimeout := sms.DefaultSendTimeout
+	if val, ok := lookupPositiveInt(envSendTimeout); ok {
+		defaultTimeout = time.Duration(val) * time.Second
+	}
+
+	timeouts := map[string]time.Duration{}
+
+	spec, ok := os.LookupEnv(envSenderTimeouts)
+	if ok {
+		parsedTimeouts, err := sms.ParseSendTimeouts(spec)
+		if err != nil {
+			log.Printf("Ignoring value of %s: %v", envSenderTimeouts, err)
+		} else {
+			timeouts = parsedTimeouts
+		}
+	}
+
+	log.Printf("Senders are allowed to take %d seconds for sending a message", int(defaultTimeout.Seconds()))
+	for i, j := range timeouts {
+		log.Printf("Sender '%s' is allowed to take %d seconds for sending a message", i, int(j.Seconds()))
+	}
+
+	return sms.NewSendTimeouts(timeouts, defaultTimeout)
+}
+
+const probeOff = "off"
+const probeWarn = "warn"
+const probeRefuse = "refuse"
+
+// verifySenders probes all senders according to the value of MN_SENDER_PROBE. It returns false if the
+// program should not be started.
+func verifySenders(addrBook sms.SmsAddressBook, timeouts *sms.SendTimeouts) bool {
+	mode, ok := os.LookupEnv(envSenderProbe)
+	if !ok {
+		mode = probeWarn
+	}
+
+	if mode == probeOff {
+		return true
+	}
+
+	if (mode != probeWarn) && (mode != probeRefuse) {
+		log.Printf("Ignoring illegal value '%s' of %s", mode, envSenderProbe)
+		mode = probeWarn
+	}
+
+	healthy := true
+
+	for _, j := range sms.ProbeAllSenders(context.Background(), addrBook, timeouts) {
+		if !j.Probed {
+			continue
+		}
+
+		if j.Healthy {
+			log.Printf("Probe of sender for address type '%s' successful", j.AddrType)
+			continue
+		}
+
+		log.Printf("********* Probe of sender for address type '%s' FAILED: %s *********", j.AddrType, j.Error)
+		healthy = false
+	}
+
+	if !healthy && (mode == probeRefuse) {
+		log.Printf("Refusing to start because at least one sender is not usable")
+		return false
+	}
+
+	return true
+}
+
+func createSenderGuard(m tools.SetMetricsValue) *logic.SenderGuard {
+	limits := map[string]logic.RateLimit{}
+
+	spec, ok := os.LookupEnv(envSenderRateLimits)
+	if ok {
+		parsedLimits, err := logic.ParseRateLimits(spec)
+		if err != nil {
+			log.Printf("Ignoring value of %s: %v", envSenderRateLimits, err)
+		} else {
+			limits = parsedLimits
+		}
+	}
+
+	for i, j := range limits {
+		log.Printf("Sender '%s' is allowed to send %d/%d/%d messages per minute/hour/day (0 means unlimited)", i, j.PerMinute, j.PerHour, j.PerDay)
+	}
+
+	threshold := logic.DefaultBreakerThreshold
+	if val, ok := lookupPositiveInt(envBreakerThreshold); ok {
+		threshold = val
+	}
+
+	cooldown := logic.DefaultBreakerCooldown
+	if val, ok := lookupPositiveInt(envBreakerCooldown); ok {
+		cooldown = time.Duration(val) * time.Second
+	}
+
+	log.Printf("Senders are not used for %d seconds after %d consecutive failures", int(cooldown.Seconds()), threshold)
+
+	return logic.NewSenderGuard(limits, threshold, cooldown, m)
+}
+
+func createUsageTracker(dblUsage repo.DBSerializer) *logic.UsageTracker {
+	caps := map[string]int{}
+
+	spec, ok := os.LookupEnv(envMonthlyCaps)
+	if ok {
+		parsedCaps, err := logic.ParseSenderLimits(spec)
+		if err != nil {
+			log.Printf("Ignoring value of %s: %v", envMonthlyCaps, err)
+		} else {
+			caps = parsedCaps
+		}
+	}
+
+	for i, j := range caps {
+		log.Printf("Low priority notifications are not sent via '%s' after %d segments per month", i, j)
+	}
+
+	return logic.NewUsageTracker(dblUsage, repo.NewBBoltUsageRepo, caps)
+}
+
+func createDeliveryPool(m tools.SetMetricsValue, t *sms.SendTimeouts, g *logic.SenderGuard) *logic.DeliveryPool {
+	limits := map[string]int{}
+
+	spec, ok := os.LookupEnv(envSenderConcurrency)
+	if ok {
+		parsedLimits, err := logic.ParseSenderLimits(spec)
+		if err != nil {
+			log.Printf("Ignoring value of %s: %v", envSenderConcurrency, err)
+		} else {
+			limits = parsedLimits
+		}
+	}
+
+	for i, j := range limits {
+		log.Printf("Sender '%s' is allowed to send %d messages concurrently", i, j)
+	}
+
+	pool := logic.NewDeliveryPool(limits, logic.DefaultSenderConcurrency, m)
+	pool.SetTimeouts(t)
+	pool.SetGuard(g)
+
+	return pool
+}
+
+func lookupPositiveInt(envName string) (int, bool) {
+	temp, ok := os.LookupEnv(envName)
+	if !ok {
+		return 0, false
+	}
+
+	val, err := strconv.ParseInt(temp, 10, 32)
+	if (err != nil) || (val <= 0) {
+		log.Printf("Ignoring illegal value '%s' of %s", temp, envName)
+		return 0, false
+	}
+
+	return int(val), true
+}
+
+func createRetryPolicy() *logic.RetryPolicy {
+	policy := logic.NewDefaultRetryPolicy()
+
+	if val, ok := lookupPositiveInt(envMaxSendAttempts); ok {
+		policy.MaxAttempts = val
+	}
+
+	if val, ok := lookupPositiveInt(envRetryBaseDelay); ok {
+		policy.BaseDelay = time.Duration(val) * time.Second
+	}
+
+	if val, ok := lookupPositiveInt(envRetryMaxDelay); ok {
+		policy.MaxDelay = time.Duration(val) * time.Second
+	}
+
+	log.Printf("Giving up on notifications after %d failed attempts", policy.MaxAttempts)
+
+	return policy
+}
+
+func determineHistoryRetention() time.Duration {
+	retention := logic.DefaultHistoryRetention
+
+	if val, ok := lookupPositiveInt(envHistoryRetention); ok {
+		retention = time.Duration(val) * 24 * time.Hour
+	}
+
+	log.Printf("Keeping delivery history for %d days", int(retention.Hours()/24))
+
+	return retention
+}
+
+// createSandbox replaces all senders by capturing senders if MN_SANDBOX is set to true. It returns nil
+// if sandbox mode is not active.
+func createSandbox(addrBook sms.SmsAddressBook) *sms.CaptureBuffer {
+	val, ok := os.LookupEnv(envSandbox)
+	if !ok {
+		return nil
+	}
+
+	active, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Printf("Ignoring illegal value '%s' of %s", val, envSandbox)
+		return nil
+	}
+
+	if !active {
+		return nil
+	}
+
+	capacity := sms.DefaultCaptureCapacity
+	if val, ok := lookupPositiveInt(envSandboxSize); ok {
+		capacity = val
+	}
+
+	buffer := sms.NewCaptureBuffer(capacity)
+	sms.EnableSandbox(addrBook, buffer)
+
+	log.Printf("********* Sandbox mode is active. No messages are sent. The last %d messages are kept in memory *********", capacity)
+
+	return buffer
+}
+
 func run() int {
 	determineClientTZFromEnvironment()
 	getTokenDefinitionsFromEnv()
@@ -254,6 +619,8 @@ func run() int {
 
 	dbl := repo.NewBoltDBLocker(rawDB)
 	dblAddr := repo.NewBoltDBLocker(rawDB)
+	dblHistory := repo.NewBoltDBLocker(rawDB)
+	dblUsage := repo.NewBoltDBLocker(rawDB)
 
 	metricCollector := tools.NewMetricsCollector()
 	metricCollector.Start()
@@ -279,9 +646,19 @@ func run() int {
 		log.Printf("No usable MQTT config found: %v", err)
 	}
 
-	smsAddressBook := createAddressBook(dblAddr, repo.NewBBoltAddressBookRepo, senderIface)
+	webPushSender := createWebPushSender(dbl, dblAddr, repo.NewBBoltAddressBookRepo)
+	smsAddressBook, closeSenders := createAddressBook(dblAddr, repo.NewBBoltAddressBookRepo, senderIface, webPushSender)
+	sandbox := createSandbox(smsAddressBook)
+
+	history := logic.NewDeliveryHistory(dblHistory, repo.NewBBoltHistoryRepo, determineHistoryRetention())
+
+	sendTimeouts := createSendTimeouts()
+	senderGuard := createSenderGuard(metricCollector.SetValue)
+	usage := createUsageTracker(dblUsage)
+	// The warner and the send endpoint share the pool, i.e. they are subject to the same limits
+	deliveryPool := createDeliveryPool(metricCollector.SetValue, sendTimeouts, senderGuard)
 
-	smsController := controller.NewSmsController(createLogger(), smsAddressBook)
+	smsController := controller.NewSmsController(createLogger(), smsAddressBook, history, deliveryPool.Send, usage)
 	smsController.AddHandlersWithAuth(authWrapper)
 
 	notificationController := controller.NewNotificationController(dbl, createLogger(), repo.NewBBoltNotificationRepo)
@@ -298,7 +675,29 @@ func run() int {
 	addrBookController := controller.NewAddressBookController(dblAddr, dbl, createLogger(), repo.NewBBoltAddressBookRepo, allAddressTypes)
 	addrBookController.AddHandlersWithAuth(authWrapper)
 
-	infoController := controller.NewGeneralController(dbl, createLogger(), metricCollector)
+	deadLetterController := controller.NewDeadLetterController(dbl, createLogger(), repo.NewBBoltDeadLetterRepo)
+	deadLetterController.AddHandlersWithAuth(authWrapper)
+
+	historyController := controller.NewHistoryController(createLogger(), history)
+	historyController.AddHandlersWithAuth(authWrapper)
+
+	usageController := controller.NewUsageController(createLogger(), usage)
+	usageController.AddHandlersWithAuth(authWrapper)
+
+	senderController := controller.NewSenderController(createLogger(), smsAddressBook, sendTimeouts)
+	senderController.AddHandlersWithAuth(authWrapper)
+
+	if webPushSender != nil {
+		webPushController := controller.NewWebPushController(dblAddr, createLogger(), repo.NewBBoltAddressBookRepo, webPushSender.Key.PublicKey())
+		webPushController.AddHandlersWithAuth(authWrapper)
+	}
+
+	if sandbox != nil {
+		sandboxController := controller.NewSandboxController(createLogger(), sandbox)
+		sandboxController.AddHandlersWithAuth(authWrapper)
+	}
+
+	infoController := controller.NewGeneralController(dbl, createLogger(), metricCollector, sandbox != nil, senderGuard)
 	infoController.AddHandlersWithAuth(authWrapper)
 
 	dirName, ok := os.LookupEnv(envServeLocal)
@@ -309,7 +708,12 @@ func run() int {
 
 	http.HandleFunc("/notifier/api/swagger/", httpSwagger.Handler(httpSwagger.URL(determineSwaggerURL())))
 
-	server, err := createWebServer()
+	// Requests are cancelled as soon as the server is asked to stop. This aborts messages which
+	// are currently sent through the send endpoint.
+	requestCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	server, err := createWebServer(requestCtx)
 	if err != nil {
 		log.Println(err)
 		return ERROR_EXIT
@@ -337,9 +741,32 @@ func run() int {
 		metricsCallback = completeMqttSetup(sender, metricsCallback)
 	}
 
-	stopWarner := logic.StartWarner(dbl, smsAddressBook, time.NewTicker(60*time.Second), createLogger(), metricsCallback)
+	// The MQTT connection has to be established before the senders are probed
+	if !verifySenders(smsAddressBook, sendTimeouts) {
+		if mqttConfigured {
+			// Otherwise the deferred call of WaitForShutdown() would block forever
+			sender.Stop()
+		}
+		return ERROR_EXIT
+	}
+
+	warnerOptions := []logic.WarnerOption{
+		logic.WithDeliveryPool(deliveryPool),
+		logic.WithRetryPolicy(createRetryPolicy()),
+		logic.WithHistory(history),
+		logic.WithUsageTracker(usage),
+	}
+
+	stopWarner := logic.StartWarner(dbl, smsAddressBook, time.NewTicker(60*time.Second), createLogger(), metricsCallback, warnerOptions...)
 	defer stopWarner()
 
+	// Stop the warner and abort all messages which are currently sent before the server is shut down.
+	// Otherwise a hanging sender could delay the shutdown.
+	tools.AddCancelFunc(stopWarner)
+	tools.AddCancelFunc(tools.NotifierCancelFunc(cancelRequests))
+	// Connections of the senders are closed when no more messages are sent
+	tools.AddCancelFunc(closeSenders)
+
 	// Register the server shutdown LAST. Serve() unblocks the moment Shutdown()
 	// returns, which lets run() return and fire its deferred functions in the defined
 	// order
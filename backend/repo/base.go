@@ -12,6 +12,10 @@ const bucketExpiryTimes = "EXPIRIES"
 const bucketParents = "PARENTS"
 const bucketReminders = "REMINDERS"
 const bucketAddressBook = "ADDRESSBOOK"
+const bucketDeadLetters = "DEADLETTERS"
+const bucketHistory = "HISTORY"
+const bucketGroups = "GROUPS"
+const bucketUsage = "USAGE"
 
 type DbType = *bolt.DB
 
@@ -119,6 +123,26 @@ func CreateBuckets(db *bolt.DB) error {
 			return fmt.Errorf("error creating bucket for the address book: %v", err)
 		}
 
+		_, err = tx.CreateBucketIfNotExists([]byte(bucketDeadLetters))
+		if err != nil {
+			return fmt.Errorf("error creating bucket for dead letters: %v", err)
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(bucketHistory))
+		if err != nil {
+			return fmt.Errorf("error creating bucket for the delivery history: %v", err)
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(bucketGroups))
+		if err != nil {
+			return fmt.Errorf("error creating bucket for recipient groups: %v", err)
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(bucketUsage))
+		if err != nil {
+			return fmt.Errorf("error creating bucket for usage statistics: %v", err)
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -4,29 +4,90 @@ import (
 	"encoding/json"
 	"fmt"
 	"notifier/tools"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
 
+// RecipientChannel specifies an additional way to reach a recipient
+type RecipientChannel struct {
+	AddrType string `json:"addr_type"`
+	Address  string `json:"address"`
+	// Options are passed to the sender when this channel is used, e.g. the QoS of an MQTT message
+	Options map[string]string `json:"options,omitempty"`
+}
+
+const AbsenceSuppress = "suppress"
+const AbsenceDefer = "defer"
+const AbsenceRedirect = "redirect"
+
+// Absence specifies a period during which a recipient does not want to receive notifications. The policy
+// determines what happens to notifications which become due during this period: they are either
+// suppressed, deferred until End or redirected to the substitute recipient.
+type Absence struct {
+	Start      time.Time   `json:"start"`
+	End        time.Time   `json:"end"`
+	Policy     string      `json:"policy"`
+	Substitute *tools.UUID `json:"substitute,omitempty"`
+}
+
+func (a *Absence) Contains(t time.Time) bool {
+	return !t.Before(a.Start) && t.Before(a.End)
+}
+
 type Recipient struct {
-	DisplayName string      `json:"display_name"`
-	Id          *tools.UUID `json:"id"`
-	Address     string      `json:"address"`
-	AddrType    string      `json:"addr_type"`
-	IsDefault   bool        `json:"is_default"`
+	DisplayName string             `json:"display_name"`
+	Id          *tools.UUID        `json:"id"`
+	Address     string             `json:"address"`
+	AddrType    string             `json:"addr_type"`
+	IsDefault   bool               `json:"is_default"`
+	Fallbacks   []RecipientChannel `json:"fallbacks,omitempty"`
+	Absences    []Absence          `json:"absences,omitempty"`
+	// Options are passed to the sender when the primary channel is used. Fallback channels have their own options.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// AbsenceAt returns the absence period which contains t or nil if the recipient is not absent at that time
+func (r *Recipient) AbsenceAt(t time.Time) *Absence {
+	for i := range r.Absences {
+		if r.Absences[i].Contains(t) {
+			return &r.Absences[i]
+		}
+	}
+
+	return nil
+}
+
+// Channels returns all ways to reach the recipient in the order in which they should be tried. The
+// first element is always defined by AddrType and Address.
+func (r *Recipient) Channels() []RecipientChannel {
+	res := []RecipientChannel{{AddrType: r.AddrType, Address: r.Address, Options: r.Options}}
+	return append(res, r.Fallbacks...)
+}
+
+// RecipientGroup is a named set of recipients. Its id can be used instead of a recipient id.
+type RecipientGroup struct {
+	Id      *tools.UUID   `json:"id"`
+	Name    string        `json:"name"`
+	Members []*tools.UUID `json:"members"`
 }
 
 type RecipientPredicate func(r *Recipient) bool
+type GroupPredicate func(g *RecipientGroup) bool
 
 type AddrBookRead interface {
 	Get(u *tools.UUID) (*Recipient, error)
 	Filter(p RecipientPredicate) ([]*Recipient, error)
+	GetGroup(u *tools.UUID) (*RecipientGroup, error)
+	FilterGroups(p GroupPredicate) ([]*RecipientGroup, error)
 }
 
 type AddrBookWrite interface {
 	AddrBookRead
 	Delete(u *tools.UUID) error
 	Upsert(r *Recipient) error
+	DeleteGroup(u *tools.UUID) error
+	UpsertGroup(g *RecipientGroup) error
 }
 
 func NewBBoltAddressBookRepo(d *bolt.DB) *BBoltAddrBookRepo {
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"notifier/tools"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DeadLetter holds a notification which could not be delivered even after several attempts
+type DeadLetter struct {
+	Notification *Notification `json:"notification"`
+	FailedAt     time.Time     `json:"failed_at"`
+	LastError    string        `json:"last_error"`
+}
+
+type DeadLetterPredicate func(d *DeadLetter) bool
+
+type DeadLetterRepoRead interface {
+	Get(u *tools.UUID) (*DeadLetter, error)
+	Filter(p DeadLetterPredicate) ([]*DeadLetter, error)
+}
+
+type DeadLetterRepoWrite interface {
+	DeadLetterRepoRead
+	Upsert(d *DeadLetter) error
+	Delete(u *tools.UUID) error
+}
+
+func NewBBoltDeadLetterRepo(db *bolt.DB) *BoltDeadLetterRepo {
+	return &BoltDeadLetterRepo{
+		db: db,
+	}
+}
+
+type BoltDeadLetterRepo struct {
+	db *bolt.DB
+}
+
+func (b *BoltDeadLetterRepo) Upsert(d *DeadLetter) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketDeadLetters))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketDeadLetters)
+		}
+
+		data, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("unable to upsert dead letter: %v", err)
+		}
+
+		err = b.Put(d.Notification.Id.AsSlice(), data)
+		if err != nil {
+			return fmt.Errorf("unable to upsert dead letter: %v", err)
+		}
+
+		return err
+	})
+
+	return err
+}
+
+func (b *BoltDeadLetterRepo) Get(u *tools.UUID) (*DeadLetter, error) {
+	var res *DeadLetter = nil
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketDeadLetters))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketDeadLetters)
+		}
+
+		v := b.Get(u.AsSlice())
+		if v == nil {
+			// value not found
+			return nil
+		}
+
+		res = new(DeadLetter)
+
+		err := json.Unmarshal(v, res)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read dead letter: %v", err)
+	}
+
+	return res, nil
+}
+
+func (b *BoltDeadLetterRepo) Delete(u *tools.UUID) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketDeadLetters))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketDeadLetters)
+		}
+
+		err := b.Delete(u.AsSlice())
+		if err != nil {
+			return fmt.Errorf("unable to delete dead letter: %v", err)
+		}
+
+		return err
+	})
+
+	return err
+}
+
+func (b *BoltDeadLetterRepo) Filter(p DeadLetterPredicate) ([]*DeadLetter, error) {
+	res := []*DeadLetter{}
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketDeadLetters))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketDeadLetters)
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			entry := new(DeadLetter)
+			err := json.Unmarshal(v, entry)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize dead letter: %v", err)
+			}
+
+			if p(entry) {
+				res = append(res, entry)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to filter dead letters: %v", err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"notifier/tools"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func (a *BBoltAddrBookRepo) GetGroup(u *tools.UUID) (*RecipientGroup, error) {
+	var res *RecipientGroup = nil
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketGroups))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketGroups)
+		}
+
+		v := b.Get(u.AsSlice())
+		if v == nil {
+			// value not found
+			return nil
+		}
+
+		res = new(RecipientGroup)
+
+		err := json.Unmarshal(v, res)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read recipient group: %v", err)
+	}
+
+	return res, nil
+}
+
+func (a *BBoltAddrBookRepo) DeleteGroup(u *tools.UUID) error {
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketGroups))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketGroups)
+		}
+
+		err := b.Delete(u.AsSlice())
+		if err != nil {
+			return fmt.Errorf("unable to delete recipient group: %v", err)
+		}
+
+		return err
+	})
+
+	return err
+}
+
+func (a *BBoltAddrBookRepo) UpsertGroup(g *RecipientGroup) error {
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketGroups))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketGroups)
+		}
+
+		data, err := json.Marshal(g)
+		if err != nil {
+			return fmt.Errorf("unable to upsert recipient group: %v", err)
+		}
+
+		err = b.Put(g.Id.AsSlice(), data)
+		if err != nil {
+			return fmt.Errorf("unable to upsert recipient group: %v", err)
+		}
+
+		return err
+	})
+
+	return err
+}
+
+func (a *BBoltAddrBookRepo) FilterGroups(p GroupPredicate) ([]*RecipientGroup, error) {
+	res := []*RecipientGroup{}
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketGroups))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketGroups)
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			entry := new(RecipientGroup)
+			err := json.Unmarshal(v, entry)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize recipient group: %v", err)
+			}
+
+			if p(entry) {
+				res = append(res, entry)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to filter recipient groups: %v", err)
+	}
+
+	return res, nil
+}
+
+// ExpandRecipients replaces all group ids in the given list by the ids of the group members. Ids
+// which do not refer to a group are kept. Each recipient appears only once in the result.
+func ExpandRecipients(addrBookRead AddrBookRead, recipients []*tools.UUID) ([]*tools.UUID, error) {
+	res := []*tools.UUID{}
+	seen := map[string]bool{}
+
+	add := func(u *tools.UUID) {
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			res = append(res, u)
+		}
+	}
+
+	for _, j := range recipients {
+		group, err := addrBookRead.GetGroup(j)
+		if err != nil {
+			return nil, err
+		}
+
+		if group == nil {
+			add(j)
+			continue
+		}
+
+		for _, k := range group.Members {
+			add(k)
+		}
+	}
+
+	return res, nil
+}
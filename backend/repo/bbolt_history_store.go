@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"notifier/tools"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const OutcomeSent = "sent"
+const OutcomeFailed = "failed"
+const OutcomeDeadLetter = "dead_letter"
+const OutcomeDiscarded = "discarded"
+const OutcomeSuppressed = "suppressed"
+const OutcomeDeferred = "deferred"
+const OutcomeRedirected = "redirected"
+
+// DeliveryRecord documents one attempt to deliver a message to a recipient
+type DeliveryRecord struct {
+	Id             *tools.UUID `json:"id"`
+	NotificationId *tools.UUID `json:"notification_id,omitempty"`
+	ReminderId     *tools.UUID `json:"reminder_id,omitempty"`
+	Recipient      *tools.UUID `json:"recipient"`
+	SenderName     string      `json:"sender_name"`
+	AddrType       string      `json:"addr_type,omitempty"`
+	Address        string      `json:"address,omitempty"`
+	Message        string      `json:"message"`
+	Time           time.Time   `json:"time"`
+	Outcome        string      `json:"outcome"`
+	Error          string      `json:"error,omitempty"`
+	Reason         string      `json:"reason,omitempty"`
+}
+
+type DeliveryRecordPredicate func(d *DeliveryRecord) bool
+
+type HistoryRepoRead interface {
+	// Filter returns at most limit records matching the predicate after skipping the first offset
+	// matching records. The records are sorted in descending order with respect to their time. The
+	// second return value is the total number of matching records. A limit <= 0 means no limit.
+	Filter(p DeliveryRecordPredicate, offset int, limit int) ([]*DeliveryRecord, int, error)
+}
+
+type HistoryRepoWrite interface {
+	HistoryRepoRead
+	Add(d *DeliveryRecord) error
+	DeleteOlderThan(t time.Time) (int, error)
+}
+
+func NewBBoltHistoryRepo(db *bolt.DB) *BoltHistoryRepo {
+	return &BoltHistoryRepo{
+		db: db,
+	}
+}
+
+type BoltHistoryRepo struct {
+	db *bolt.DB
+}
+
+// historyKey makes sure that the entries in the history bucket are sorted by time
+func historyKey(d *DeliveryRecord) []byte {
+	key := int64ToBigEndian(d.Time.UnixNano())
+	return append(key, d.Id.AsSlice()...)
+}
+
+func (b *BoltHistoryRepo) Add(d *DeliveryRecord) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketHistory))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketHistory)
+		}
+
+		data, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("unable to add delivery record: %v", err)
+		}
+
+		err = b.Put(historyKey(d), data)
+		if err != nil {
+			return fmt.Errorf("unable to add delivery record: %v", err)
+		}
+
+		return err
+	})
+
+	return err
+}
+
+func (b *BoltHistoryRepo) DeleteOlderThan(t time.Time) (int, error) {
+	count := 0
+	limit := int64ToBigEndian(t.UnixNano())
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketHistory))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketHistory)
+		}
+
+		c := b.Cursor()
+
+		for k, _ := c.First(); (k != nil) && (bytes.Compare(k[:8], limit) < 0); k, _ = c.First() {
+			err := c.Delete()
+			if err != nil {
+				return fmt.Errorf("unable to delete delivery record: %v", err)
+			}
+
+			count++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to purge history: %v", err)
+	}
+
+	return count, nil
+}
+
+func (b *BoltHistoryRepo) Filter(p DeliveryRecordPredicate, offset int, limit int) ([]*DeliveryRecord, int, error) {
+	res := []*DeliveryRecord{}
+	total := 0
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketHistory))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketHistory)
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			entry := new(DeliveryRecord)
+			err := json.Unmarshal(v, entry)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize delivery record: %v", err)
+			}
+
+			if !p(entry) {
+				continue
+			}
+
+			if (total >= offset) && ((limit <= 0) || (len(res) < limit)) {
+				res = append(res, entry)
+			}
+
+			total++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to filter history: %v", err)
+	}
+
+	return res, total, nil
+}
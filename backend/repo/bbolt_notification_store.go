@@ -51,7 +51,7 @@ func (b *BoltNotificationRepo) Upsert(n *Notification) error {
 			return fmt.Errorf("bucket '%s' not found", bucketExpiryTimes)
 		}
 
-		unixTimeStamp := n.WarningTime.Unix()
+		unixTimeStamp := n.DueTime().Unix()
 
 		err = b.Put(n.Id.AsSlice(), int64ToBigEndian(unixTimeStamp))
 		if err != nil {
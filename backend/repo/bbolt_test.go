@@ -339,3 +339,285 @@ func Test3(t *testing.T) {
 		return
 	}
 }
+
+func Test4(t *testing.T) {
+	recipientId, _ := tools.NewUuidFromString(TestRecipient)
+	os.Remove(pathTestDb)
+
+	db, err := bolt.Open(pathTestDb, 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database file %s: %v\n", pathTestDb, err)
+	}
+	defer func() {
+		db.Close()
+		fmt.Println("bbolt DB closed")
+		os.Remove(pathTestDb)
+	}()
+
+	err = CreateBuckets(db)
+	if err != nil {
+		t.Errorf("Creating buckets failed: %v", err)
+		return
+	}
+
+	var r NotificationRepoWrite = NewBBoltNotificationRepo(db)
+	var d DeadLetterRepoWrite = NewBBoltDeadLetterRepo(db)
+
+	testUUID1, _ := tools.NewUuidFromString(Uuid1)
+	testUUID2, _ := tools.NewUuidFromString(Uuid2)
+
+	now := time.Now().UTC()
+
+	n := Notification{
+		Id:          testUUID1,
+		Parent:      testUUID2,
+		WarningTime: now.Add(-time.Minute),
+		Description: "Test notification",
+		Recipient:   recipientId,
+		Attempts:    1,
+		NextAttempt: now.Add(time.Hour),
+	}
+
+	err = r.Upsert(&n)
+	if err != nil {
+		t.Errorf("Insert failed: %v", err)
+		return
+	}
+
+	res, err := r.GetExpired(now)
+	if err != nil {
+		t.Errorf("Get expired notfications failed: %v", err)
+		return
+	}
+
+	if len(res) != 0 {
+		t.Errorf("Retry time of notification was not respected")
+	}
+
+	res, err = r.GetExpired(now.Add(2 * time.Hour))
+	if err != nil {
+		t.Errorf("Get expired notfications failed: %v", err)
+		return
+	}
+
+	if len(res) != 1 {
+		t.Errorf("Wrong number of expired notifications: %d", len(res))
+	}
+
+	err = d.Upsert(&DeadLetter{Notification: &n, FailedAt: now, LastError: "failed"})
+	if err != nil {
+		t.Errorf("Insert of dead letter failed: %v", err)
+		return
+	}
+
+	dl, err := d.Get(testUUID1)
+	if err != nil {
+		t.Errorf("Getting dead letter failed: %v", err)
+		return
+	}
+
+	if (dl == nil) || (dl.Notification.Attempts != 1) || (dl.LastError != "failed") {
+		t.Errorf("Wrong dead letter data retrieved")
+		return
+	}
+
+	err = d.Delete(testUUID1)
+	if err != nil {
+		t.Errorf("Deleting dead letter failed: %v", err)
+		return
+	}
+
+	all, err := d.Filter(func(*DeadLetter) bool { return true })
+	if err != nil {
+		t.Errorf("Filtering dead letters failed: %v", err)
+		return
+	}
+
+	if len(all) != 0 {
+		t.Errorf("Wrong number of dead letters: %d", len(all))
+	}
+}
+
+func Test5(t *testing.T) {
+	recipientId, _ := tools.NewUuidFromString(TestRecipient)
+	recipientId2, _ := tools.NewUuidFromString(TestRecipient2)
+	os.Remove(pathTestDb)
+
+	db, err := bolt.Open(pathTestDb, 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database file %s: %v\n", pathTestDb, err)
+	}
+	defer func() {
+		db.Close()
+		fmt.Println("bbolt DB closed")
+		os.Remove(pathTestDb)
+	}()
+
+	err = CreateBuckets(db)
+	if err != nil {
+		t.Errorf("Creating buckets failed: %v", err)
+		return
+	}
+
+	var h HistoryRepoWrite = NewBBoltHistoryRepo(db)
+	refTime := time.Now().UTC()
+
+	for i := range 10 {
+		r := recipientId
+		if i%2 == 1 {
+			r = recipientId2
+		}
+
+		err = h.Add(&DeliveryRecord{
+			Id:        tools.UUIDGen(),
+			Recipient: r,
+			Time:      refTime.Add(time.Duration(i-10) * time.Hour),
+			Outcome:   OutcomeSent,
+		})
+		if err != nil {
+			t.Errorf("Adding delivery record failed: %v", err)
+			return
+		}
+	}
+
+	res, total, err := h.Filter(func(d *DeliveryRecord) bool { return d.Recipient.IsEqual(recipientId) }, 1, 2)
+	if err != nil {
+		t.Errorf("Filtering failed: %v", err)
+		return
+	}
+
+	if (total != 5) || (len(res) != 2) {
+		t.Errorf("Wrong number of results: %d, %d", total, len(res))
+		return
+	}
+
+	if !res[0].Time.After(res[1].Time) {
+		t.Errorf("Wrong order of results")
+	}
+
+	count, err := h.DeleteOlderThan(refTime.Add(-5 * time.Hour))
+	if err != nil {
+		t.Errorf("Purging failed: %v", err)
+		return
+	}
+
+	if count != 5 {
+		t.Errorf("Wrong number of purged records: %d", count)
+	}
+
+	_, total, err = h.Filter(func(d *DeliveryRecord) bool { return true }, 0, 0)
+	if err != nil {
+		t.Errorf("Filtering failed: %v", err)
+		return
+	}
+
+	if total != 5 {
+		t.Errorf("Wrong number of remaining records: %d", total)
+	}
+}
+
+func Test6(t *testing.T) {
+	recipientId, _ := tools.NewUuidFromString(TestRecipient)
+	recipientId2, _ := tools.NewUuidFromString(TestRecipient2)
+	groupId, _ := tools.NewUuidFromString(Uuid1)
+	os.Remove(pathTestDb)
+
+	db, err := bolt.Open(pathTestDb, 0600, nil)
+	if err != nil {
+		t.Fatalf("Unable to open database file %s: %v\n", pathTestDb, err)
+	}
+	defer func() {
+		db.Close()
+		fmt.Println("bbolt DB closed")
+		os.Remove(pathTestDb)
+	}()
+
+	err = CreateBuckets(db)
+	if err != nil {
+		t.Errorf("Creating buckets failed: %v", err)
+		return
+	}
+
+	var a AddrBookWrite = NewBBoltAddressBookRepo(db)
+
+	g := RecipientGroup{
+		Id:      groupId,
+		Name:    "Family",
+		Members: []*tools.UUID{recipientId, recipientId2},
+	}
+
+	err = a.UpsertGroup(&g)
+	if err != nil {
+		t.Errorf("Upserting group failed: %v", err)
+		return
+	}
+
+	read, err := a.GetGroup(groupId)
+	if err != nil {
+		t.Errorf("Reading group failed: %v", err)
+		return
+	}
+
+	if (read == nil) || (read.Name != g.Name) || (len(read.Members) != 2) {
+		t.Errorf("Group not read correctly: %v", read)
+		return
+	}
+
+	expanded, err := ExpandRecipients(a, []*tools.UUID{recipientId2, groupId})
+	if err != nil {
+		t.Errorf("Expanding recipients failed: %v", err)
+		return
+	}
+
+	if (len(expanded) != 2) || !expanded[0].IsEqual(recipientId2) || !expanded[1].IsEqual(recipientId) {
+		t.Errorf("Recipients not expanded correctly: %v", expanded)
+		return
+	}
+
+	err = a.DeleteGroup(groupId)
+	if err != nil {
+		t.Errorf("Deleting group failed: %v", err)
+		return
+	}
+
+	groups, err := a.FilterGroups(func(*RecipientGroup) bool { return true })
+	if err != nil {
+		t.Errorf("Filtering groups failed: %v", err)
+		return
+	}
+
+	if len(groups) != 0 {
+		t.Errorf("Group was not deleted")
+		return
+	}
+}
+
+func Test7(t *testing.T) {
+	substitute, _ := tools.NewUuidFromString(TestRecipient2)
+	start := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	r := Recipient{
+		Absences: []Absence{
+			{Start: start, End: start.Add(24 * time.Hour), Policy: AbsenceSuppress},
+			{Start: start.Add(48 * time.Hour), End: start.Add(72 * time.Hour), Policy: AbsenceRedirect, Substitute: substitute},
+		},
+	}
+
+	if r.AbsenceAt(start.Add(-time.Second)) != nil {
+		t.Errorf("Recipient should not be absent before the first period")
+	}
+
+	a := r.AbsenceAt(start)
+	if (a == nil) || (a.Policy != AbsenceSuppress) {
+		t.Errorf("Wrong absence at start of first period: %v", a)
+	}
+
+	if r.AbsenceAt(start.Add(24*time.Hour)) != nil {
+		t.Errorf("End of absence period should be exclusive")
+	}
+
+	a = r.AbsenceAt(start.Add(50 * time.Hour))
+	if (a == nil) || (a.Policy != AbsenceRedirect) || !a.Substitute.IsEqual(substitute) {
+		t.Errorf("Wrong absence in second period: %v", a)
+	}
+}
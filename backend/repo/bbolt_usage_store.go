@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"notifier/tools"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// UsageEntry contains the number of message segments which were sent to a recipient through a
+// sender in a calendar month. Month has the form YYYY-MM. Recipient is nil for messages which can
+// not be attributed to a recipient.
+type UsageEntry struct {
+	Month     string      `json:"month"`
+	Sender    string      `json:"sender"`
+	Recipient *tools.UUID `json:"recipient,omitempty"`
+	Segments  int         `json:"segments"`
+}
+
+type UsageRepoRead interface {
+	// GetMonth returns all entries of the given month
+	GetMonth(month string) ([]*UsageEntry, error)
+}
+
+type UsageRepoWrite interface {
+	UsageRepoRead
+	// Add adds the given number of segments to the entry of month, sender and recipient
+	Add(month string, sender string, recipient *tools.UUID, segments int) error
+}
+
+func NewBBoltUsageRepo(db *bolt.DB) *BoltUsageRepo {
+	return &BoltUsageRepo{
+		db: db,
+	}
+}
+
+type BoltUsageRepo struct {
+	db *bolt.DB
+}
+
+// usageKey makes sure that all entries of a month are stored next to each other
+func usageKey(month string, sender string, recipient *tools.UUID) []byte {
+	key := []byte(month + "/")
+	if recipient != nil {
+		key = append(key, recipient.AsSlice()...)
+	}
+
+	return append(append(key, '/'), []byte(sender)...)
+}
+
+func (b *BoltUsageRepo) Add(month string, sender string, recipient *tools.UUID, segments int) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketUsage))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketUsage)
+		}
+
+		key := usageKey(month, sender, recipient)
+		entry := &UsageEntry{
+			Month:     month,
+			Sender:    sender,
+			Recipient: recipient,
+		}
+
+		v := b.Get(key)
+		if v != nil {
+			err := json.Unmarshal(v, entry)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize usage entry: %v", err)
+			}
+		}
+
+		entry.Segments += segments
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("unable to serialize usage entry: %v", err)
+		}
+
+		return b.Put(key, data)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to update usage: %v", err)
+	}
+
+	return nil
+}
+
+func (b *BoltUsageRepo) GetMonth(month string) ([]*UsageEntry, error) {
+	res := []*UsageEntry{}
+	prefix := []byte(month + "/")
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketUsage))
+		if b == nil {
+			return fmt.Errorf("bucket '%s' not found", bucketUsage)
+		}
+
+		c := b.Cursor()
+
+		for k, v := c.Seek(prefix); (k != nil) && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			entry := new(UsageEntry)
+			err := json.Unmarshal(v, entry)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize usage entry: %v", err)
+			}
+
+			res = append(res, entry)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read usage: %v", err)
+	}
+
+	return res, nil
+}
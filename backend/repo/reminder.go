@@ -7,6 +7,7 @@ import (
 
 type ReminderType int
 type WarningType int
+type Priority int
 
 const (
 	Anniversary ReminderType = iota + 1
@@ -23,12 +24,34 @@ const (
 	SameDay
 )
 
+// The zero value is PriorityNormal. This keeps reminders which were stored without a priority valid.
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+	PriorityUrgent Priority = 2
+)
+
 type Notification struct {
 	Id          *tools.UUID `json:"id"`
 	Parent      *tools.UUID `json:"parent"`
 	WarningTime time.Time   `json:"warning_time"`
 	Description string      `json:"description"`
 	Recipient   *tools.UUID `json:"recipient"`
+	EventTime   time.Time   `json:"event_time,omitzero"`
+	Attempts    int         `json:"attempts,omitempty"`
+	NextAttempt time.Time   `json:"next_attempt,omitzero"`
+	LastError   string      `json:"last_error,omitempty"`
+}
+
+// DueTime returns the point in time at which the notification is to be sent. This is the warning time
+// unless a failed delivery attempt has scheduled a retry for a later point in time.
+func (n *Notification) DueTime() time.Time {
+	if n.NextAttempt.After(n.WarningTime) {
+		return n.NextAttempt
+	}
+
+	return n.WarningTime
 }
 
 type Reminder struct {
@@ -39,6 +62,9 @@ type Reminder struct {
 	Spec        time.Time     `json:"spec"`
 	Description string        `json:"description"`
 	Recipients  []*tools.UUID `json:"recipients"`
+	Priority    Priority      `json:"priority,omitempty"`
+	// Options are passed to the senders of all notifications of this reminder, e.g. the mail subject
+	Options map[string]string `json:"options,omitempty"`
 }
 
 type NotificationPredicate func(r *Notification) bool
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
@@ -22,14 +23,15 @@ type SimpleServer struct {
 	server        *http.Server
 }
 
-func newSimpleServer(p uint16, localOnly bool) *SimpleServer {
+func newSimpleServer(ctx context.Context, p uint16, localOnly bool) *SimpleServer {
 	addr := fmt.Sprintf(":%d", p)
 	if localOnly {
 		addr = "localhost" + addr
 	}
 
 	httpServer := &http.Server{
-		Addr: addr,
+		Addr:        addr,
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	res := SimpleServer{
@@ -64,15 +66,16 @@ func (t *TlsServer) Shutdown(ctx context.Context) error {
 	return t.server.Shutdown(ctx)
 }
 
-func newTlsServer(p uint16, crtFile string, keyFile string) (*TlsServer, error) {
+func newTlsServer(ctx context.Context, p uint16, crtFile string, keyFile string) (*TlsServer, error) {
 	tlsConfig := &tls.Config{
 		ClientAuth: tls.NoClientCert,
 		MinVersion: tls.VersionTLS12,
 	}
 
 	httpServer := &http.Server{
-		Addr:      fmt.Sprintf(":%d", p),
-		TLSConfig: tlsConfig,
+		Addr:        fmt.Sprintf(":%d", p),
+		TLSConfig:   tlsConfig,
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	srv := TlsServer{
@@ -85,7 +88,8 @@ func newTlsServer(p uint16, crtFile string, keyFile string) (*TlsServer, error)
 	return &srv, nil
 }
 
-func createWebServer() (WebServer, error) {
+// createWebServer creates a server whose request contexts are derived from ctx
+func createWebServer(ctx context.Context) (WebServer, error) {
 	var listenerPort uint16 = DefaultPort
 	var certFileName string
 	var keyFileName string
@@ -116,14 +120,14 @@ func createWebServer() (WebServer, error) {
 	}
 
 	if okKey && okCert && (!localHostOnly) {
-		res, err = newTlsServer(listenerPort, certFileName, keyFileName)
+		res, err = newTlsServer(ctx, listenerPort, certFileName, keyFileName)
 		if err != nil {
 			return nil, fmt.Errorf("Unable to build TLS server object: %v", err)
 		}
 
 		log.Println("Using TLS")
 	} else {
-		res = newSimpleServer(listenerPort, localHostOnly)
+		res = newSimpleServer(ctx, listenerPort, localHostOnly)
 		log.Println("Using plain HTTP")
 		if localHostOnly {
 			log.Println("Only listening on localhost")
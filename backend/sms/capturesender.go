@@ -0,0 +1,159 @@
+package sms
+
+import (
+	"context"
+	"notifier/repo"
+	"notifier/tools"
+	"sync"
+	"time"
+)
+
+const DefaultCaptureCapacity = 100
+
+// CapturedMessage is a message which was captured in sandbox mode instead of being sent
+type CapturedMessage struct {
+	Time                time.Time     `json:"time"`
+	AddrType            string        `json:"addr_type"`
+	Sender              string        `json:"sender"`
+	Address             string        `json:"address"`
+	Message             string        `json:"message"`
+	RecipientId         *tools.UUID   `json:"recipient_id,omitempty"`
+	NotificationId      *tools.UUID   `json:"notification_id,omitempty"`
+	ReminderId          *tools.UUID   `json:"reminder_id,omitempty"`
+	ReminderDescription string        `json:"reminder_description,omitempty"`
+	Priority            repo.Priority `json:"priority"`
+}
+
+// CaptureBuffer stores the most recent captured messages. When it is full the oldest message is
+// overwritten.
+type CaptureBuffer struct {
+	mutex    sync.Mutex
+	messages []CapturedMessage
+	next     int
+	full     bool
+}
+
+func NewCaptureBuffer(capacity int) *CaptureBuffer {
+	if capacity < 1 {
+		capacity = DefaultCaptureCapacity
+	}
+
+	return &CaptureBuffer{
+		messages: make([]CapturedMessage, capacity),
+	}
+}
+
+func (c *CaptureBuffer) Add(m CapturedMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.messages[c.next] = m
+	c.next = (c.next + 1) % len(c.messages)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// GetAll returns the captured messages. The most recent message comes first.
+func (c *CaptureBuffer) GetAll() []CapturedMessage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	count := c.next
+	if c.full {
+		count = len(c.messages)
+	}
+
+	res := make([]CapturedMessage, 0, count)
+
+	for i := 1; i <= count; i++ {
+		res = append(res, c.messages[(c.next-i+len(c.messages))%len(c.messages)])
+	}
+
+	return res
+}
+
+func (c *CaptureBuffer) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	clear(c.messages)
+	c.next = 0
+	c.full = false
+}
+
+// CapturingSender replaces the sender of an address type in sandbox mode. It stores all messages in a
+// CaptureBuffer instead of sending them. It has the same name and the same length limit as the sender
+// it replaces and counts segments in the same way. Therefore concurrency limits, timeouts, usage
+// statistics and the splitting of long messages work in the same way as for the real sender.
+type CapturingSender struct {
+	addrType string
+	name     string
+	limit    MessageLimit
+	counter  SegmentCounter
+	buffer   *CaptureBuffer
+}
+
+func NewCapturingSender(addrType string, replaced SmsSender, b *CaptureBuffer) *CapturingSender {
+	res := &CapturingSender{
+		addrType: addrType,
+		name:     replaced.GetName(),
+		buffer:   b,
+	}
+
+	limited, ok := replaced.(LengthLimitedSender)
+	if ok {
+		res.limit = limited.MaxMessageLength()
+	}
+
+	counter, ok := replaced.(SegmentCounter)
+	if ok {
+		res.counter = counter
+	}
+
+	return res
+}
+
+func (c *CapturingSender) GetName() string {
+	return c.name
+}
+
+func (c *CapturingSender) MaxMessageLength() MessageLimit {
+	return c.limit
+}
+
+// Segments counts the segments in the same way as the replaced sender
+func (c *CapturingSender) Segments(message string) int {
+	if c.counter == nil {
+		return 1
+	}
+
+	return c.counter.Segments(message)
+}
+
+func (c *CapturingSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	c.buffer.Add(CapturedMessage{
+		Time:                time.Now().UTC(),
+		AddrType:            c.addrType,
+		Sender:              c.name,
+		Address:             recipientAddress,
+		Message:             message,
+		RecipientId:         info.RecipientId,
+		NotificationId:      info.NotificationId,
+		ReminderId:          info.ReminderId,
+		ReminderDescription: info.ReminderDescription,
+		Priority:            info.Priority,
+	})
+
+	return nil
+}
+
+// EnableSandbox replaces the senders of all address types by capturing senders which use the given buffer
+func EnableSandbox(addrBook SmsAddressBook, b *CaptureBuffer) {
+	for _, j := range addrBook.GetAllAddressTypes() {
+		sender := addrBook.GetSender(j)
+		if sender != nil {
+			addrBook.AddSender(j, NewCapturingSender(j, sender, b))
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestCaptureBuffer(t *testing.T) {
+	b := NewCaptureBuffer(3)
+
+	if len(b.GetAll()) != 0 {
+		t.Fatalf("New buffer is not empty")
+	}
+
+	for i := 1; i <= 5; i++ {
+		b.Add(CapturedMessage{Message: fmt.Sprint(i)})
+
+		messages := b.GetAll()
+		if len(messages) != min(i, 3) {
+			t.Fatalf("Wrong number of messages after %d additions: %d", i, len(messages))
+		}
+
+		for j, m := range messages {
+			if m.Message != fmt.Sprint(i-j) {
+				t.Errorf("Wrong order after %d additions: %v", i, messages)
+			}
+		}
+	}
+
+	b.Clear()
+
+	if len(b.GetAll()) != 0 {
+		t.Errorf("Buffer is not empty after clearing it")
+	}
+}
+
+func TestCapturingSender(t *testing.T) {
+	addrBook := NewDBAddressBook(nil, nil)
+	addrBook.AddSender(TypeIFTTT, NewDummySender())
+	addrBook.AddSender(TypeMail, &mailNotifier{})
+
+	b := NewCaptureBuffer(10)
+	EnableSandbox(addrBook, b)
+
+	sender := addrBook.GetSender(TypeIFTTT)
+	if _, ok := sender.(*CapturingSender); !ok {
+		t.Fatalf("Sender was not replaced")
+	}
+
+	// The length limit of the replaced sender still applies
+	message := "This is a message which is too long for a single SMS. Therefore it has to be split into two parts before it can be sent. This is done by the fallback logic which is also used by the warner."
+	channels := []Channel{{AddrType: TypeIFTTT, Address: "123", Sender: sender}}
+
+	_, err := SendWithFallback(context.Background(), channels, message, &MessageInfo{}, func(ctx context.Context, s SmsSender, addr string, msg string, info *MessageInfo) error {
+		return s.Send(ctx, addr, msg, info)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := b.GetAll()
+	if len(messages) != 2 {
+		t.Fatalf("Expected two parts, got %d", len(messages))
+	}
+
+	if (messages[0].Sender != sender.GetName()) || (messages[0].AddrType != TypeIFTTT) || (messages[0].Address != "123") {
+		t.Errorf("Wrong message captured: %v", messages[0])
+	}
+
+	if _, ok := addrBook.GetSender(TypeMail).(ProbingSender); ok {
+		t.Errorf("Capturing sender must not probe the replaced sender")
+	}
+}
@@ -0,0 +1,233 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const envCommandPath = "MN_COMMAND_PATH"
+const envCommandAllowList = "MN_COMMAND_ALLOWLIST"
+const envCommandInput = "MN_COMMAND_INPUT"
+const envCommandTimeout = "MN_COMMAND_TIMEOUT"
+
+// Ways in which address and message are passed to the command
+const CommandInputArgs = "args"
+const CommandInputEnv = "env"
+const CommandInputStdin = "stdin"
+
+const defaultCommandTimeout = 10 * time.Second
+
+// Only the end of the error output is reported
+const commandMaxErrorOutput = 200
+
+// Environment variables which are passed to the command
+const commandEnvAddress = "NOTIFIER_ADDRESS"
+const commandEnvMessage = "NOTIFIER_MESSAGE"
+const commandEnvRecipientId = "NOTIFIER_RECIPIENT_ID"
+const commandEnvReminderId = "NOTIFIER_REMINDER_ID"
+const commandEnvDescription = "NOTIFIER_DESCRIPTION"
+const commandEnvPriority = "NOTIFIER_PRIORITY"
+
+// CommandSender executes a local program for each message. Depending on Input the address and the
+// message are passed as arguments, via the environment or the message is written to stdin while the
+// address is passed as an argument. The program does not inherit the environment of mobilenotifier,
+// i.e. it has no access to the secrets contained therein. An exit code other than zero signals an error.
+type CommandSender struct {
+	Path    string
+	Input   string
+	Timeout time.Duration
+}
+
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to access command: %v", err)
+	}
+
+	if !info.Mode().IsRegular() || (info.Mode().Perm()&0111 == 0) {
+		return fmt.Errorf("'%s' is not an executable file", path)
+	}
+
+	return nil
+}
+
+// NewCommandSender returns an error if path does not refer to an executable file
+func NewCommandSender(path string, input string, timeout time.Duration) (*CommandSender, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("path of command has to be absolute")
+	}
+
+	err := checkExecutable(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains([]string{CommandInputArgs, CommandInputEnv, CommandInputStdin}, input) {
+		return nil, fmt.Errorf("unknown input mode '%s'", input)
+	}
+
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+
+	res := &CommandSender{
+		Path:    path,
+		Input:   input,
+		Timeout: timeout,
+	}
+
+	return res, nil
+}
+
+// resolvePath returns the absolute path of the file after all symbolic links have been followed
+func resolvePath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path '%s' is not absolute", path)
+	}
+
+	return filepath.EvalSymlinks(path)
+}
+
+// isCommandAllowed returns true if path refers to one of the files in the comma separated allow list
+func isCommandAllowed(path string, allowList string) bool {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return false
+	}
+
+	for _, j := range strings.Split(allowList, ",") {
+		allowed, err := resolvePath(strings.TrimSpace(j))
+		if (err == nil) && (allowed == resolved) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewCommandSenderFromEnvironment only creates a sender if the command referenced by MN_COMMAND_PATH is
+// contained in the allow list MN_COMMAND_ALLOWLIST
+func NewCommandSenderFromEnvironment() (*CommandSender, error) {
+	path, ok := os.LookupEnv(envCommandPath)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envCommandPath)
+	}
+
+	allowList, ok := os.LookupEnv(envCommandAllowList)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envCommandAllowList)
+	}
+
+	if !isCommandAllowed(path, allowList) {
+		return nil, fmt.Errorf("Command '%s' is not contained in %s", path, envCommandAllowList)
+	}
+
+	input, ok := os.LookupEnv(envCommandInput)
+	if !ok {
+		input = CommandInputArgs
+	}
+
+	timeout := defaultCommandTimeout
+
+	timeoutStr, ok := os.LookupEnv(envCommandTimeout)
+	if ok {
+		val, err := strconv.ParseUint(timeoutStr, 10, 32)
+		if (err != nil) || (val == 0) {
+			return nil, fmt.Errorf("Value of %s is not a positive number of seconds", envCommandTimeout)
+		}
+
+		timeout = time.Duration(val) * time.Second
+	}
+
+	return NewCommandSender(path, input, timeout)
+}
+
+func (c *CommandSender) GetName() string {
+	return TypeCommand
+}
+
+// Probe checks whether the command is still an executable file
+func (c *CommandSender) Probe(ctx context.Context) error {
+	return checkExecutable(c.Path)
+}
+
+func (c *CommandSender) environment(recipientAddress string, message string, info *MessageInfo) []string {
+	res := []string{
+		"PATH=" + os.Getenv("PATH"),
+		commandEnvAddress + "=" + recipientAddress,
+		commandEnvDescription + "=" + info.ReminderDescription,
+		commandEnvPriority + "=" + strconv.Itoa(int(info.Priority)),
+	}
+
+	if info.RecipientId != nil {
+		res = append(res, commandEnvRecipientId+"="+info.RecipientId.String())
+	}
+
+	if info.ReminderId != nil {
+		res = append(res, commandEnvReminderId+"="+info.ReminderId.String())
+	}
+
+	if c.Input == CommandInputEnv {
+		res = append(res, commandEnvMessage+"="+message)
+	}
+
+	return res
+}
+
+func (c *CommandSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	var args []string
+
+	// "--" prevents that the address or the message is interpreted as an option by the command
+	switch c.Input {
+	case CommandInputArgs:
+		args = []string{"--", recipientAddress, message}
+	case CommandInputStdin:
+		args = []string{"--", recipientAddress}
+	}
+
+	cmd := exec.CommandContext(ctx, c.Path, args...)
+	cmd.Env = c.environment(recipientAddress, message, info)
+	cmd.Dir = filepath.Dir(c.Path)
+	// Do not wait for processes which were started by the command and still hold its output open
+	cmd.WaitDelay = time.Second
+
+	if c.Input == CommandInputStdin {
+		cmd.Stdin = strings.NewReader(message)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("command aborted: %w", ctx.Err())
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		output := strings.TrimSpace(stderr.String())
+		if len(output) > commandMaxErrorOutput {
+			output = "..." + output[len(output)-commandMaxErrorOutput:]
+		}
+
+		return fmt.Errorf("command exited with code %d: %s", exitErr.ExitCode(), output)
+	}
+
+	return fmt.Errorf("unable to execute command: %v", err)
+}
@@ -0,0 +1,120 @@
+package sms
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeScript(t *testing.T, dir string, name string, script string) string {
+	path := filepath.Join(dir, name)
+
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestCommandSender(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	t.Setenv("MN_SECRET_FOR_TEST", "geheim")
+
+	script := writeScript(t, dir, "notify.sh", `printf '%s|%s|%s|%s|%s' "$1" "$2" "$3" "$NOTIFIER_DESCRIPTION" "$MN_SECRET_FOR_TEST" > `+out)
+
+	sender, err := NewCommandSender(script, CommandInputArgs, time.Second)
+	if err != nil {
+		t.Fatalf("Unable to create sender: %v", err)
+	}
+
+	err = sender.Send(context.Background(), "wohnzimmer", "Fenster schließen", &MessageInfo{ReminderDescription: "Lüften"})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(out)
+	if string(data) != "--|wohnzimmer|Fenster schließen|Lüften|" {
+		t.Errorf("Wrong data passed to command: %s", string(data))
+	}
+
+	err = sender.Send(context.Background(), "-rf", "--help", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	data, _ = os.ReadFile(out)
+	if string(data) != "--|-rf|--help||" {
+		t.Errorf("Options not separated from address and message: %s", string(data))
+	}
+
+	stdinScript := writeScript(t, dir, "stdin.sh", `{ printf '%s|%s|' "$1" "$2"; cat; } > `+out)
+	sender, _ = NewCommandSender(stdinScript, CommandInputStdin, time.Second)
+	_ = sender.Send(context.Background(), "küche", "Herd aus", &MessageInfo{})
+
+	data, _ = os.ReadFile(out)
+	if string(data) != "--|küche|Herd aus" {
+		t.Errorf("Wrong data passed via stdin: %s", string(data))
+	}
+
+	envScript := writeScript(t, dir, "env.sh", `printf '%s|%s' "$NOTIFIER_ADDRESS" "$NOTIFIER_MESSAGE" > `+out)
+	sender, _ = NewCommandSender(envScript, CommandInputEnv, time.Second)
+	_ = sender.Send(context.Background(), "flur", "Licht aus", &MessageInfo{})
+
+	data, _ = os.ReadFile(out)
+	if string(data) != "flur|Licht aus" {
+		t.Errorf("Wrong data passed via environment: %s", string(data))
+	}
+
+	failing := writeScript(t, dir, "fail.sh", `echo "device not found" >&2; exit 4`)
+	sender, _ = NewCommandSender(failing, CommandInputArgs, time.Second)
+	err = sender.Send(context.Background(), "a", "b", &MessageInfo{})
+	if (err == nil) || !strings.Contains(err.Error(), "code 4: device not found") {
+		t.Errorf("Exit code not reported: %v", err)
+	}
+
+	hanging := writeScript(t, dir, "hang.sh", `sleep 10`)
+	sender, _ = NewCommandSender(hanging, CommandInputArgs, 100*time.Millisecond)
+	start := time.Now()
+	err = sender.Send(context.Background(), "a", "b", &MessageInfo{})
+	if (err == nil) || (time.Since(start) > 5*time.Second) {
+		t.Errorf("Timeout not enforced: %v", err)
+	}
+}
+
+func TestCommandAllowList(t *testing.T) {
+	dir := t.TempDir()
+	allowed := writeScript(t, dir, "allowed.sh", "exit 0")
+	other := writeScript(t, dir, "other.sh", "exit 0")
+
+	link := filepath.Join(dir, "link.sh")
+	err := os.Symlink(allowed, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isCommandAllowed(link, "/usr/bin/true, "+allowed) {
+		t.Errorf("Allowed command rejected")
+	}
+
+	if isCommandAllowed(other, allowed) || isCommandAllowed("allowed.sh", allowed) {
+		t.Errorf("Command accepted which is not in allow list")
+	}
+
+	t.Setenv(envCommandPath, other)
+	t.Setenv(envCommandAllowList, allowed)
+
+	_, err = NewCommandSenderFromEnvironment()
+	if err == nil {
+		t.Errorf("Sender created for command which is not allowed")
+	}
+
+	_, err = NewCommandSender(filepath.Join(dir, "out"), CommandInputArgs, time.Second)
+	if err == nil {
+		t.Errorf("Sender created for missing file")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"notifier/repo"
 	"notifier/tools"
+	"time"
 )
 
 const TypeIFTTT = "IFTTT"
@@ -11,20 +12,50 @@ const TypeMail = "Mail"
 const TypeDummy = "Dummy"
 const TypeLocal = "local"
 const TypeMqtt = "MQTT"
+const TypeNtfy = "ntfy"
+const TypeGotify = "Gotify"
+const TypeTelegram = "Telegram"
+const TypeMatrix = "Matrix"
+const TypeSignal = "Signal"
+const TypePushover = "Pushover"
+const TypeSmpp = "SMPP"
+const TypeWebPush = "WebPush"
+const TypeCommand = "Command"
 
 type RecipientInfo struct {
 	Id          *tools.UUID `json:"id"`
 	DisplayName string      `json:"display_name"`
+	IsGroup     bool        `json:"is_group"`
+}
+
+// Channel is a way to reach a recipient, i.e. an address and the sender which is able to use it
+type Channel struct {
+	AddrType string
+	Address  string
+	Sender   SmsSender
+	Options  map[string]string
+	// Owner is the id of the recipient to which the channel belongs
+	Owner *tools.UUID
 }
 
 type SmsAddressBook interface {
 	ListRecipients() ([]RecipientInfo, error)
-	GetSender(recipientId *tools.UUID) SmsSender
 	AddSender(addrType string, s SmsSender)
 	SetDefaultType(t string)
-	CheckRecipient(r *tools.UUID) (bool, string, error)
+	// CheckRecipient returns true if the recipient exists. In this case the second return value contains
+	// all channels which can be used to reach the recipient in the order in which they are to be tried.
+	CheckRecipient(r *tools.UUID) (bool, []Channel, error)
+	// GetAbsence returns the absence period of the recipient which contains t. It returns nil if the
+	// recipient is not absent at that time.
+	GetAbsence(r *tools.UUID, t time.Time) (*repo.Absence, error)
+	// IsGroup returns true if the id refers to a recipient group
+	IsGroup(r *tools.UUID) (bool, error)
+	// ExpandRecipients replaces group ids by the ids of the group members
+	ExpandRecipients(recipients []*tools.UUID) ([]*tools.UUID, error)
 	GetDefaultRecipientIds() []string
 	GetAllAddressTypes() []string
+	// GetSender returns the sender which was added for the address type. It returns nil if there is none.
+	GetSender(addrType string) SmsSender
 }
 
 func NewDBAddressBook(d repo.DBSerializer, g func(repo.DbType) *repo.BBoltAddrBookRepo) *DBAddressBook {
@@ -66,42 +97,108 @@ func (d *DBAddressBook) ListRecipients() ([]RecipientInfo, error) {
 		result = append(result, h)
 	}
 
+	groups, err := readRepo.FilterGroups(func(*repo.RecipientGroup) bool { return true })
+	if err != nil {
+		return nil, fmt.Errorf("error getting all recipient groups: %v", err)
+	}
+
+	for _, j := range groups {
+		h := RecipientInfo{
+			Id:          j.Id,
+			DisplayName: j.Name,
+			IsGroup:     true,
+		}
+		result = append(result, h)
+	}
+
 	return result, nil
 }
 
-func (d *DBAddressBook) GetSender(recipientId *tools.UUID) SmsSender {
-	defaultSender := d.senders[d.defaultType]
+func (d *DBAddressBook) GetAbsence(r *tools.UUID, t time.Time) (*repo.Absence, error) {
+	readRepo := repo.LockAndGetRepoR(d.db, d.genRead)
+	defer func() { d.db.RUnlock() }()
+
+	recipient, err := readRepo.Get(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read recipient '%s': %v", r, err)
+	}
+
+	if recipient == nil {
+		return nil, nil
+	}
 
+	return recipient.AbsenceAt(t), nil
+}
+
+func (d *DBAddressBook) IsGroup(r *tools.UUID) (bool, error) {
 	readRepo := repo.LockAndGetRepoR(d.db, d.genRead)
 	defer func() { d.db.RUnlock() }()
 
-	recipient, err := readRepo.Get(recipientId)
-	if (err != nil) || (recipient == nil) {
-		return defaultSender
+	group, err := readRepo.GetGroup(r)
+	if err != nil {
+		return false, fmt.Errorf("unable to read recipient group '%s': %v", r, err)
 	}
 
-	sender, ok := d.senders[recipient.AddrType]
+	return group != nil, nil
+}
+
+func (d *DBAddressBook) ExpandRecipients(recipients []*tools.UUID) ([]*tools.UUID, error) {
+	readRepo := repo.LockAndGetRepoR(d.db, d.genRead)
+	defer func() { d.db.RUnlock() }()
+
+	return repo.ExpandRecipients(readRepo, recipients)
+}
+
+func (d *DBAddressBook) GetSender(addrType string) SmsSender {
+	return d.senders[addrType]
+}
+
+func (d *DBAddressBook) getSender(addrType string) SmsSender {
+	sender, ok := d.senders[addrType]
 	if !ok {
-		return defaultSender
+		return d.senders[d.defaultType]
 	}
 
 	return sender
 }
 
-func (d *DBAddressBook) CheckRecipient(r *tools.UUID) (bool, string, error) {
+func (d *DBAddressBook) CheckRecipient(r *tools.UUID) (bool, []Channel, error) {
 	readRepo := repo.LockAndGetRepoR(d.db, d.genRead)
 	defer func() { d.db.RUnlock() }()
 
 	recipient, err := readRepo.Get(r)
 	if err != nil {
-		return false, "", fmt.Errorf("unable to determine validity of recipient: '%s'", r)
+		return false, nil, fmt.Errorf("unable to determine validity of recipient: '%s'", r)
 	}
 
 	if recipient == nil {
-		return false, "", nil
+		return false, nil, nil
+	}
+
+	channels := []Channel{}
+
+	for i, j := range recipient.Channels() {
+		// Only the primary channel falls back to the default sender. Otherwise the address of a fallback
+		// channel would be handed to a sender which is unable to interpret it.
+		sender := d.senders[j.AddrType]
+		if i == 0 {
+			sender = d.getSender(j.AddrType)
+		}
+
+		if sender == nil {
+			continue
+		}
+
+		channels = append(channels, Channel{
+			AddrType: j.AddrType,
+			Address:  j.Address,
+			Sender:   sender,
+			Options:  j.Options,
+			Owner:    recipient.Id,
+		})
 	}
 
-	return true, recipient.Address, nil
+	return true, channels, nil
 }
 
 func (d *DBAddressBook) GetDefaultRecipientIds() []string {
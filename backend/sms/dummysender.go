@@ -1,6 +1,7 @@
 package sms
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -12,16 +13,16 @@ func NewDummySender() *dummySmsSender {
 type dummySmsSender struct {
 }
 
+// MaxMessageLength returns the length of a single SMS. Longer messages are split into several SMS.
+func (i *dummySmsSender) MaxMessageLength() MessageLimit {
+	return SmsLimit
+}
+
 func (i *dummySmsSender) GetName() string {
 	return "IFTTT - dummy"
 }
 
-func (i *dummySmsSender) Send(recipientAddress string, message string) error {
-	if len([]rune(message)) > lenMessageMax {
-		temp := message
-		message = string([]rune(temp)[:lenMessageMax])
-	}
-
+func (i *dummySmsSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
 	fmt.Printf("Sending '%s' using address '%s'\n", message, recipientAddress)
 
 	return nil
@@ -0,0 +1,144 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SendFunc is used to send a message through a sender, e.g. by applying additional restrictions
+type SendFunc func(ctx context.Context, s SmsSender, recipientAddress string, message string, info *MessageInfo) error
+
+func DirectSend(ctx context.Context, s SmsSender, recipientAddress string, message string, info *MessageInfo) error {
+	return s.Send(ctx, recipientAddress, message, info)
+}
+
+// ContinuationPrefix marks a message which contains the rest of a message whose first parts were
+// already delivered
+const ContinuationPrefix = "(...) "
+
+// PartialDeliveryError is returned by SendWithFallback if the first parts of a message were delivered
+// but the rest could not be sent. Remaining is the message which has to be sent in order to deliver
+// the rest. It is marked as a continuation. Senders which split messages on their own return it without
+// the mark if they were only able to send the first parts. Delivered contains the messages which were
+// actually sent. It is only filled by SendWithFallback.
+type PartialDeliveryError struct {
+	Remaining string
+	Delivered []DeliveredMessage
+	Err       error
+}
+
+// DeliveredMessage is a message or the beginning of a message which was sent through the channel
+type DeliveredMessage struct {
+	Channel *Channel
+	Message string
+}
+
+func (p *PartialDeliveryError) Error() string {
+	return fmt.Sprintf("message only partially delivered: %v", p.Err)
+}
+
+func (p *PartialDeliveryError) Unwrap() error {
+	return p.Err
+}
+
+func isPartialDelivery(err error) bool {
+	var partial *PartialDeliveryError
+	return errors.As(err, &partial)
+}
+
+// sendParts sends the parts of a message beginning with the part at index first one after the other.
+// It returns the number of parts which were sent successfully, including those before first. If the
+// sender was only able to deliver the beginning of a part, this part is replaced by its rest. All
+// messages which were sent are appended to delivered.
+func sendParts(ctx context.Context, channel *Channel, parts []string, first int, info *MessageInfo, send SendFunc, delivered *[]DeliveredMessage) (int, error) {
+	for i := first; i < len(parts); i++ {
+		partInfo := *info
+		partInfo.PendingParts = len(parts) - i
+		partInfo.FollowUp = i > first
+
+		err := send(ctx, channel.Sender, channel.Address, parts[i], &partInfo)
+		if err != nil {
+			var partial *PartialDeliveryError
+			if errors.As(err, &partial) {
+				*delivered = append(*delivered, DeliveredMessage{Channel: channel, Message: strings.TrimSuffix(parts[i], partial.Remaining)})
+				parts[i] = ContinuationPrefix + partial.Remaining
+			}
+
+			if len(parts) > 1 {
+				return i, fmt.Errorf("part %d of %d: %w", i+1, len(parts), err)
+			}
+
+			return i, err
+		}
+
+		*delivered = append(*delivered, DeliveredMessage{Channel: channel, Message: parts[i]})
+	}
+
+	return len(parts), nil
+}
+
+// remainder returns the text of all parts beginning with the part at index first without their numbering
+func remainder(parts []string, first int) string {
+	res := []string{}
+
+	for i := first; i < len(parts); i++ {
+		part := strings.TrimPrefix(parts[i], numberingPrefix(i+1, len(parts)))
+		res = append(res, strings.TrimPrefix(part, ContinuationPrefix))
+	}
+
+	return strings.Join(res, " ")
+}
+
+// SendWithFallback tries the channels in the given order until the message was successfully sent. The
+// senders receive a copy of info which contains the options of the channel in use. Messages which are
+// too long for a sender are split into several parts. If sending one of the parts fails, the remaining
+// parts are sent again through the same channel. If this also fails, the next channel is used for the
+// rest of the message, which is marked as a continuation. It returns the channel which was used. If all
+// channels fail, the returned error contains the errors of all channels. If some parts were delivered
+// the error is a PartialDeliveryError.
+func SendWithFallback(ctx context.Context, channels []Channel, message string, info *MessageInfo, send SendFunc) (*Channel, error) {
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("no usable channel found")
+	}
+
+	allErrors := []error{}
+	delivered := []DeliveredMessage{}
+
+	for i := range channels {
+		channelInfo := *info
+		channelInfo.RecipientOptions = channels[i].Options
+		channelInfo.ChannelOwnerId = channels[i].Owner
+
+		parts := SplitForSender(channels[i].Sender, message)
+
+		sent, err := sendParts(ctx, &channels[i], parts, 0, &channelInfo, send, &delivered)
+		progress := (sent > 0) || isPartialDelivery(err)
+		if (err != nil) && progress && (ctx.Err() == nil) {
+			// Parts which were already delivered are not sent again
+			sent, err = sendParts(ctx, &channels[i], parts, sent, &channelInfo, send, &delivered)
+		}
+
+		if err == nil {
+			return &channels[i], nil
+		}
+
+		allErrors = append(allErrors, fmt.Errorf("sending via '%s' failed: %w", channels[i].AddrType, err))
+
+		if progress || (sent > 0) {
+			message = ContinuationPrefix + remainder(parts, sent)
+		}
+
+		// There is no point in trying the other channels if sending was aborted
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(delivered) > 0 {
+		return nil, &PartialDeliveryError{Remaining: message, Delivered: delivered, Err: errors.Join(allErrors...)}
+	}
+
+	return nil, errors.Join(allErrors...)
+}
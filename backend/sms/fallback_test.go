@@ -0,0 +1,212 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"notifier/repo"
+	"notifier/tools"
+	"path/filepath"
+	"testing"
+)
+
+type failingSender struct {
+	fail     bool
+	received []string
+	options  map[string]string
+}
+
+func (f *failingSender) GetName() string {
+	return "failing"
+}
+
+func (f *failingSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	if f.fail {
+		return fmt.Errorf("sending to '%s' failed", recipientAddress)
+	}
+
+	f.received = append(f.received, message)
+	f.options = info.RecipientOptions
+
+	return nil
+}
+
+func TestSendWithFallback(t *testing.T) {
+	broken := &failingSender{fail: true}
+	working := &failingSender{fail: false}
+
+	channels := []Channel{
+		{AddrType: "MQTT", Address: "topic", Sender: broken},
+		{AddrType: "Mail", Address: "a@b.de", Sender: working, Options: map[string]string{OptionSubjectPrefix: "[Info]"}},
+	}
+
+	used, err := SendWithFallback(context.Background(), channels, "test", &MessageInfo{}, DirectSend)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (used.AddrType != "Mail") || (len(working.received) != 1) {
+		t.Errorf("Wrong channel used: %s", used.AddrType)
+	}
+
+	if working.options[OptionSubjectPrefix] != "[Info]" {
+		t.Errorf("Options of channel not passed to sender: %v", working.options)
+	}
+
+	_, err = SendWithFallback(context.Background(), channels[:1], "test", &MessageInfo{}, DirectSend)
+	if err == nil {
+		t.Errorf("Sending should have failed")
+	}
+
+	_, err = SendWithFallback(context.Background(), []Channel{}, "test", &MessageInfo{}, DirectSend)
+	if err == nil {
+		t.Errorf("Sending without channels should have failed")
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	err := ValidateRecipientOptions(map[string]string{OptionQos: "2", OptionRetain: "true", OptionSubjectPrefix: "[Familie]"})
+	if err != nil {
+		t.Errorf("Valid recipient options rejected: %v", err)
+	}
+
+	err = ValidateRecipientOptions(map[string]string{OptionQos: "3"})
+	if err == nil {
+		t.Errorf("Illegal QoS accepted")
+	}
+
+	err = ValidateRecipientOptions(map[string]string{OptionSubject: "Test"})
+	if err == nil {
+		t.Errorf("Reminder option accepted for recipient")
+	}
+
+	err = ValidateReminderOptions(map[string]string{OptionSubject: "Test", OptionSubjectFromDescription: "false"})
+	if err != nil {
+		t.Errorf("Valid reminder options rejected: %v", err)
+	}
+
+	err = ValidateReminderOptions(map[string]string{OptionSubjectFromDescription: "vielleicht"})
+	if err == nil {
+		t.Errorf("Illegal boolean accepted")
+	}
+}
+
+// limitedSender fails when it is asked to send one of the parts listed in failures. Each entry is
+// only used once.
+type limitedSender struct {
+	failures []int
+	calls    int
+	received []string
+}
+
+func (l *limitedSender) GetName() string {
+	return "limited"
+}
+
+func (l *limitedSender) MaxMessageLength() MessageLimit {
+	return MessageLimit{GSM7: 20, UCS2: 10}
+}
+
+func (l *limitedSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	l.calls++
+
+	for i, j := range l.failures {
+		if j == l.calls {
+			l.failures = append(l.failures[:i], l.failures[i+1:]...)
+			return fmt.Errorf("part could not be sent")
+		}
+	}
+
+	l.received = append(l.received, message)
+
+	return nil
+}
+
+func TestSendWithFallbackSecondPartFails(t *testing.T) {
+	message := "one two three four five six seven eight"
+
+	// The second part fails once and is then sent again through the same channel
+	sender := &limitedSender{failures: []int{2}}
+	_, err := SendWithFallback(context.Background(), []Channel{{AddrType: "SMS", Sender: sender}}, message, &MessageInfo{}, DirectSend)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (len(sender.received) != 3) || (sender.received[0] != "(1/3) one two three") || (sender.received[1] != "(2/3) four five six") {
+		t.Errorf("Parts sent more than once: %v", sender.received)
+	}
+
+	// The second part fails twice. The rest of the message is sent through the fallback channel.
+	sender = &limitedSender{failures: []int{2, 3}}
+	fallback := &failingSender{}
+	channels := []Channel{{AddrType: "SMS", Sender: sender}, {AddrType: "Mail", Sender: fallback}}
+
+	used, err := SendWithFallback(context.Background(), channels, message, &MessageInfo{}, DirectSend)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (used.AddrType != "Mail") || (len(sender.received) != 1) || (len(fallback.received) != 1) {
+		t.Fatalf("Wrong channels used: %v %v", sender.received, fallback.received)
+	}
+
+	if fallback.received[0] != ContinuationPrefix+"four five six seven eight" {
+		t.Errorf("Fallback did not receive continuation: '%s'", fallback.received[0])
+	}
+
+	// All channels fail after the first part was delivered
+	sender = &limitedSender{failures: []int{2, 3}}
+	_, err = SendWithFallback(context.Background(), []Channel{{AddrType: "SMS", Sender: sender}}, message, &MessageInfo{}, DirectSend)
+
+	var partial *PartialDeliveryError
+	if !errors.As(err, &partial) || (partial.Remaining != ContinuationPrefix+"four five six seven eight") {
+		t.Fatalf("Partial delivery not reported: %v", err)
+	}
+
+	if (len(partial.Delivered) != 1) || (partial.Delivered[0].Message != "(1/3) one two three") || (partial.Delivered[0].Channel.AddrType != "SMS") {
+		t.Errorf("Wrong delivered parts: %v", partial.Delivered)
+	}
+}
+
+// TestCheckRecipientFallbacks checks that fallback channels whose address type has no sender are skipped
+// instead of being sent through the default sender
+func TestCheckRecipientFallbacks(t *testing.T) {
+	db, err := repo.InitDB(filepath.Join(t.TempDir(), "addr.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	id := tools.UUIDGen()
+	err = repo.NewBBoltAddressBookRepo(db).Upsert(&repo.Recipient{
+		DisplayName: "Test",
+		Id:          id,
+		Address:     "event",
+		AddrType:    "Unknown",
+		Fallbacks: []repo.RecipientChannel{
+			{AddrType: TypeMail, Address: "a@b.de"},
+			{AddrType: TypeTelegram, Address: "12345"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrBook := NewDBAddressBook(repo.NewBoltDBLocker(db), repo.NewBBoltAddressBookRepo)
+	addrBook.AddSender(TypeIFTTT, NewDummySender())
+	addrBook.AddSender(TypeMail, &failingSender{})
+
+	ok, channels, err := addrBook.CheckRecipient(id)
+	if (err != nil) || !ok {
+		t.Fatalf("Recipient not found: %v", err)
+	}
+
+	// The primary channel uses the default sender, the Telegram channel is skipped
+	if (len(channels) != 2) || (channels[0].Sender.GetName() != NewDummySender().GetName()) || (channels[1].AddrType != TypeMail) {
+		t.Fatalf("Wrong channels: %v", channels)
+	}
+
+	if !channels[0].Owner.IsEqual(id) || !channels[1].Owner.IsEqual(id) {
+		t.Errorf("Owner of channels not set")
+	}
+}
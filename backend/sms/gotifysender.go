@@ -0,0 +1,98 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"notifier/repo"
+	"notifier/tools"
+	"os"
+	"strings"
+)
+
+const envGotifyServer = "MN_GOTIFY_SERVER"
+
+var gotifyPriorities = map[repo.Priority]int{
+	repo.PriorityLow:    2,
+	repo.PriorityNormal: 5,
+	repo.PriorityHigh:   7,
+	repo.PriorityUrgent: 10,
+}
+
+type gotifyMessage struct {
+	Title    string `json:"title,omitempty"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// GotifySender posts messages to a Gotify server. As the messages of a Gotify application are delivered
+// to the user who owns the application the address of a recipient is the token of an application of
+// this user.
+type GotifySender struct {
+	ServerUrl string
+	Client    *http.Client
+}
+
+func NewGotifySender(serverUrl string, c *http.Client) *GotifySender {
+	return &GotifySender{
+		ServerUrl: strings.TrimSuffix(serverUrl, "/"),
+		Client:    c,
+	}
+}
+
+func NewGotifySenderFromEnvironment() (*GotifySender, error) {
+	serverUrl, ok := os.LookupEnv(envGotifyServer)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envGotifyServer)
+	}
+
+	client, err := tools.MakeCustomHttpClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom HTTP client object: %v", err)
+	}
+
+	return NewGotifySender(serverUrl, client), nil
+}
+
+func (g *GotifySender) GetName() string {
+	return TypeGotify
+}
+
+func (g *GotifySender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	gotifyMsg := gotifyMessage{
+		Title:    info.ReminderDescription,
+		Message:  message,
+		Priority: gotifyPriorities[info.Priority],
+	}
+
+	body, err := json.Marshal(&gotifyMsg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.ServerUrl+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", recipientAddress)
+
+	res, err := g.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Ignore body
+	io.ReadAll(res.Body)
+
+	if (res.StatusCode < 200) || (res.StatusCode >= 300) {
+		return fmt.Errorf("server responded with error code %d", res.StatusCode)
+	}
+
+	return nil
+}
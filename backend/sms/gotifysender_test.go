@@ -0,0 +1,53 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"notifier/repo"
+	"testing"
+)
+
+func TestGotifySender(t *testing.T) {
+	var got gotifyMessage
+	var gotPath, gotToken string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotToken = r.Header.Get("X-Gotify-Key")
+
+		if gotToken != "app-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	sender := NewGotifySender(server.URL+"/", server.Client())
+
+	info := MessageInfo{
+		ReminderDescription: "Müll rausbringen",
+		Priority:            repo.PriorityHigh,
+	}
+
+	err := sender.Send(context.Background(), "app-token", "Morgen ist Abholung", &info)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if gotPath != "/message" {
+		t.Errorf("Wrong path: %s", gotPath)
+	}
+
+	if (got.Title != "Müll rausbringen") || (got.Message != "Morgen ist Abholung") || (got.Priority != 7) {
+		t.Errorf("Wrong message: %v", got)
+	}
+
+	err = sender.Send(context.Background(), "wrong-token", "test", &MessageInfo{})
+	if err == nil {
+		t.Errorf("Error status was not detected")
+	}
+}
@@ -0,0 +1,63 @@
+package sms
+
+// The GSM 03.38 default alphabet. The position of a character is its code. Code 0x1B is the escape
+// character which introduces a character from the extension table.
+const gsm7BasicChars = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+const gsm7Escape = 0x1B
+
+var gsm7Extension = map[rune]byte{
+	'\f': 0x0A,
+	'^':  0x14,
+	'{':  0x28,
+	'}':  0x29,
+	'\\': 0x2F,
+	'[':  0x3C,
+	'~':  0x3D,
+	']':  0x3E,
+	'|':  0x40,
+	'€':  0x65,
+}
+
+var gsm7Basic = func() map[rune]byte {
+	res := map[rune]byte{}
+
+	for i, j := range []rune(gsm7BasicChars) {
+		if j != gsm7Escape {
+			res[j] = byte(i)
+		}
+	}
+
+	return res
+}()
+
+// EncodeGSM7 returns the septets which represent the text in the GSM 7 bit default alphabet. Each
+// septet is stored in its own byte. Characters from the extension table need two septets. The second
+// return value is false if the text contains characters which can not be represented.
+func EncodeGSM7(text string) ([]byte, bool) {
+	res := []byte{}
+
+	for _, j := range text {
+		code, ok := gsm7Basic[j]
+		if ok {
+			res = append(res, code)
+			continue
+		}
+
+		code, ok = gsm7Extension[j]
+		if !ok {
+			return nil, false
+		}
+
+		res = append(res, gsm7Escape, code)
+	}
+
+	return res, true
+}
+
+// IsGSM7 returns true if the text can be represented in the GSM 7 bit default alphabet
+func IsGSM7(text string) bool {
+	_, ok := EncodeGSM7(text)
+	return ok
+}
@@ -0,0 +1,85 @@
+package sms
+
+import (
+	"fmt"
+	"notifier/repo"
+	"notifier/tools"
+	"strings"
+	"time"
+)
+
+const icalProductId = "-//mobilenotifier//Reminder//DE"
+const icalUidDomain = "mobilenotifier"
+const icalTimeFormat = "20060102T150405Z"
+const icalDateFormat = "20060102"
+
+// Lines of an iCalendar object should not be longer than 75 octets (RFC 5545, section 3.1)
+const icalMaxLineLen = 75
+
+var icalEscaper = strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\r\n", "\\n", "\n", "\\n")
+
+// icalFold splits a content line into lines of at most 75 octets without splitting UTF-8 sequences
+func icalFold(line string) string {
+	var res strings.Builder
+
+	lineLen := 0
+	for _, j := range line {
+		l := len(string(j))
+		if lineLen+l > icalMaxLineLen {
+			res.WriteString("\r\n ")
+			lineLen = 1
+		}
+
+		res.WriteRune(j)
+		lineLen += l
+	}
+
+	res.WriteString("\r\n")
+
+	return res.String()
+}
+
+// CalendarUid returns the UID of the event which represents the given occurrence of a reminder. It
+// does not change when several notifications are sent for the same occurrence, i.e. a calendar
+// which imports the event more than once updates the existing entry.
+func CalendarUid(reminderId *tools.UUID, eventTime time.Time) string {
+	return fmt.Sprintf("%s-%s@%s", reminderId, eventTime.UTC().Format(icalTimeFormat), icalUidDomain)
+}
+
+// CalendarEvent creates an iCalendar object which contains a VEVENT for the occurrence of the reminder
+// described by info. Anniversaries are represented as all day events in the time zone of the client.
+func CalendarEvent(info *MessageInfo, message string, now time.Time) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + icalProductId,
+		"METHOD:PUBLISH",
+		"BEGIN:VEVENT",
+		"UID:" + CalendarUid(info.ReminderId, info.EventTime),
+		"DTSTAMP:" + now.UTC().Format(icalTimeFormat),
+	}
+
+	if info.ReminderKind == repo.Anniversary {
+		day := info.EventTime.In(tools.ClientTZ())
+		lines = append(lines,
+			"DTSTART;VALUE=DATE:"+day.Format(icalDateFormat),
+			"DTEND;VALUE=DATE:"+day.AddDate(0, 0, 1).Format(icalDateFormat),
+		)
+	} else {
+		lines = append(lines, "DTSTART:"+info.EventTime.UTC().Format(icalTimeFormat))
+	}
+
+	lines = append(lines,
+		"SUMMARY:"+icalEscaper.Replace(info.ReminderDescription),
+		"DESCRIPTION:"+icalEscaper.Replace(message),
+		"END:VEVENT",
+		"END:VCALENDAR",
+	)
+
+	var res strings.Builder
+	for _, j := range lines {
+		res.WriteString(icalFold(j))
+	}
+
+	return res.String()
+}
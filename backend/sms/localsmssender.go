@@ -2,6 +2,7 @@ package sms
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -53,16 +54,16 @@ func NewLocalSenderFromEnvironment() (*LocalSmsSender, error) {
 	return NewLocalSender(url, token, client), nil
 }
 
+// MaxMessageLength returns the length of a single SMS. Longer messages are split into several SMS.
+func (l *LocalSmsSender) MaxMessageLength() MessageLimit {
+	return SmsLimit
+}
+
 func (l *LocalSmsSender) GetName() string {
 	return "local"
 }
 
-func (l *LocalSmsSender) Send(recipientAddress string, message string) error {
-	if len([]rune(message)) > lenMessageMax {
-		temp := message
-		message = string([]rune(temp)[:lenMessageMax])
-	}
-
+func (l *LocalSmsSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
 	smsReq := SendRequest{
 		Message: message,
 		PhoneNr: recipientAddress,
@@ -73,7 +74,7 @@ func (l *LocalSmsSender) Send(recipientAddress string, message string) error {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, l.ServiceUrl, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.ServiceUrl, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -96,3 +97,26 @@ func (l *LocalSmsSender) Send(recipientAddress string, message string) error {
 
 	return nil
 }
+
+// Probe checks whether the service can be reached. As the service is not required to support HEAD
+// requests, every response which does not signal a server error is accepted.
+func (l *LocalSmsSender) Probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, l.ServiceUrl, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("X-Token", l.Jwt)
+
+	res, err := l.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("server responded with error code %d", res.StatusCode)
+	}
+
+	return nil
+}
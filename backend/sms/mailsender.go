@@ -1,24 +1,68 @@
 package sms
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
 	"net/smtp"
+	"net/textproto"
+	"notifier/tools"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// Ways to protect the connection to the SMTP server
+const MailSecurityStartTls = "starttls"
+const MailSecurityTls = "tls"
+const MailSecurityNone = "none"
+
+// Supported authentication methods
+const MailAuthPlain = "plain"
+const MailAuthLogin = "login"
+const MailAuthCramMd5 = "cram-md5"
+const MailAuthNone = "none"
+
+// Port which is used for SMTP with implicit TLS (RFC 8314)
+const mailImplicitTlsPort = 465
+
+const mailTimeout = 30 * time.Second
+
 type mailNotifier struct {
 	Host         string
 	Port         uint16
 	SenderAdress string
 	Password     string
 	Subject      string
+	// User is used for authentication. If it is empty the sender address is used.
+	User      string
+	Security  string
+	Auth      string
+	TlsConfig *tls.Config
+	Timeout   time.Duration
+	// AttachCalendar controls whether mails which are sent for a reminder contain an iCalendar event
+	AttachCalendar bool
 }
 
 const envMailServer = "MN_MAIL_SERVER"
 const envServerPort = "MN_MAIL_SERVER_PORT"
 const envSenderAddress = "MN_MAIL_SENDER_ADDR"
 const envServerPassword = "MN_MAIL_SENDER_PW"
+const envMailUser = "MN_MAIL_USER"
+const envMailSecurity = "MN_MAIL_SECURITY"
+const envMailAuth = "MN_MAIL_AUTH"
+const envMailCalendar = "MN_MAIL_ICALENDAR"
 
 func NewMailNotifierFromEnvironment() (*mailNotifier, error) {
 	mailServer, ok := os.LookupEnv(envMailServer)
@@ -43,12 +87,57 @@ func NewMailNotifierFromEnvironment() (*mailNotifier, error) {
 		return nil, fmt.Errorf("no mailer config found")
 	}
 
-	password, ok := os.LookupEnv(envServerPassword)
+	auth, ok := os.LookupEnv(envMailAuth)
 	if !ok {
+		auth = MailAuthPlain
+	}
+
+	auth = strings.ToLower(auth)
+	if (auth != MailAuthPlain) && (auth != MailAuthLogin) && (auth != MailAuthCramMd5) && (auth != MailAuthNone) {
+		return nil, fmt.Errorf("unknown authentication method '%s'", auth)
+	}
+
+	// A password is not needed if the server does not require authentication
+	password, ok := os.LookupEnv(envServerPassword)
+	if !ok && (auth != MailAuthNone) {
 		return nil, fmt.Errorf("no mailer config found")
 	}
 
-	return NewMailNotifier(mailServer, port16, senderAddr, password), nil
+	security, ok := os.LookupEnv(envMailSecurity)
+	if !ok {
+		security = MailSecurityStartTls
+		if port == mailImplicitTlsPort {
+			security = MailSecurityTls
+		}
+	}
+
+	security = strings.ToLower(security)
+	if (security != MailSecurityStartTls) && (security != MailSecurityTls) && (security != MailSecurityNone) {
+		return nil, fmt.Errorf("unknown connection security '%s'", security)
+	}
+
+	attachCalendar := false
+	calendar, ok := os.LookupEnv(envMailCalendar)
+	if ok {
+		attachCalendar, err = strconv.ParseBool(calendar)
+		if err != nil {
+			return nil, fmt.Errorf("Value of %s is not a boolean", envMailCalendar)
+		}
+	}
+
+	tlsConfig, err := tools.MakeCustomTlsConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom TLS config: %v", err)
+	}
+
+	res := NewMailNotifier(mailServer, port16, senderAddr, password)
+	res.User, _ = os.LookupEnv(envMailUser)
+	res.Security = security
+	res.Auth = auth
+	res.TlsConfig = tlsConfig
+	res.AttachCalendar = attachCalendar
+
+	return res, nil
 }
 
 func NewMailNotifier(h string, p uint16, s string, pw string) *mailNotifier {
@@ -58,6 +147,9 @@ func NewMailNotifier(h string, p uint16, s string, pw string) *mailNotifier {
 		SenderAdress: s,
 		Password:     pw,
 		Subject:      "Benachrichtigung",
+		Security:     MailSecurityStartTls,
+		Auth:         MailAuthPlain,
+		Timeout:      mailTimeout,
 	}
 
 	return res
@@ -67,20 +159,353 @@ func (m *mailNotifier) SetSubject(s string) {
 	m.Subject = s
 }
 
+// subject determines the subject of a mail. The subject option of the reminder takes precedence over
+// its description which in turn is only used if the reminder asks for it. Otherwise the global subject
+// is used. The subject prefix of the recipient is prepended in all cases.
+func (m *mailNotifier) subject(info *MessageInfo) string {
+	subject := m.Subject
+
+	if val, ok := info.ReminderOptions[OptionSubject]; ok && (val != "") {
+		subject = val
+	} else if boolOption(info.ReminderOptions, OptionSubjectFromDescription) && (info.ReminderDescription != "") {
+		subject = info.ReminderDescription
+	}
+
+	prefix := info.RecipientOptions[OptionSubjectPrefix]
+	if prefix != "" {
+		subject = prefix + " " + subject
+	}
+
+	return subject
+}
+
 func (m *mailNotifier) GetName() string {
 	return "Mail"
 }
 
-func (m *mailNotifier) Send(recipientAddress string, message string) error {
-	to := []string{recipientAddress}
+func (m *mailNotifier) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	msg, err := m.buildMessage(recipientAddress, message, info, time.Now())
+	if err != nil {
+		return err
+	}
+
+	err = m.transmit(ctx, recipientAddress, msg)
+	if (err != nil) && (ctx.Err() != nil) {
+		return fmt.Errorf("sending mail aborted: %w", ctx.Err())
+	}
+
+	return err
+}
+
+func (m *mailNotifier) tlsConfig() *tls.Config {
+	res := &tls.Config{}
+	if m.TlsConfig != nil {
+		res = m.TlsConfig.Clone()
+	}
+
+	res.ServerName = m.Host
+
+	return res
+}
+
+func (m *mailNotifier) smtpAuth() smtp.Auth {
+	user := m.User
+	if user == "" {
+		user = m.SenderAdress
+	}
+
+	switch m.Auth {
+	case MailAuthNone:
+		return nil
+	case MailAuthLogin:
+		return &loginAuth{user: user, password: m.Password, host: m.Host}
+	case MailAuthCramMd5:
+		return smtp.CRAMMD5Auth(user, m.Password)
+	default:
+		return smtp.PlainAuth("", user, m.Password, m.Host)
+	}
+}
+
+// session connects and authenticates to the configured server. After that f is called to perform the
+// remaining dialogue. The connection is closed as soon as ctx is done, which aborts the dialogue.
+func (m *mailNotifier) session(ctx context.Context, f func(c *smtp.Client) error) error {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(int(m.Port)))
+	dialer := &net.Dialer{Timeout: m.Timeout}
+
+	var conn net.Conn
+	var err error
+
+	if m.Security == MailSecurityTls {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: m.tlsConfig()}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to connect to mail server: %v", err)
+	}
+
+	conn.SetDeadline(time.Now().Add(m.Timeout))
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer func() { c.Close() }()
+
+	if m.Security == MailSecurityStartTls {
+		ok, _ := c.Extension("STARTTLS")
+		if !ok {
+			return fmt.Errorf("mail server does not support STARTTLS")
+		}
+
+		err = c.StartTLS(m.tlsConfig())
+		if err != nil {
+			return err
+		}
+	}
+
+	auth := m.smtpAuth()
+	if auth != nil {
+		err = c.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = f(c)
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// transmit performs the SMTP dialogue which sends the message to the recipient
+func (m *mailNotifier) transmit(ctx context.Context, recipientAddress string, msg []byte) error {
+	return m.session(ctx, func(c *smtp.Client) error {
+		err := c.Mail(m.SenderAdress)
+		if err != nil {
+			return err
+		}
+
+		err = c.Rcpt(recipientAddress)
+		if err != nil {
+			return err
+		}
+
+		w, err := c.Data()
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(msg)
+		if err != nil {
+			return err
+		}
+
+		return w.Close()
+	})
+}
+
+// Probe connects and authenticates to the mail server without sending a message
+func (m *mailNotifier) Probe(ctx context.Context) error {
+	return m.session(ctx, func(c *smtp.Client) error {
+		return nil
+	})
+}
+
+// buildMessage creates a multipart/alternative message which contains the text as plain text and as HTML.
+// If a calendar event is attached, this is wrapped into a multipart/mixed message.
+func (m *mailNotifier) buildMessage(recipientAddress string, message string, info *MessageInfo, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+
+	mw := multipart.NewWriter(&body)
+
+	err := writeMailPart(mw, "text/plain; charset=UTF-8", message)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeMailPart(mw, "text/html; charset=UTF-8", mailHtml(message))
+	if err != nil {
+		return nil, err
+	}
+
+	err = mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	content := body.Bytes()
+	contentType := fmt.Sprintf("multipart/alternative; boundary=\"%s\"", mw.Boundary())
+
+	if m.AttachCalendar && (info.ReminderId != nil) && !info.EventTime.IsZero() {
+		var mixed bytes.Buffer
+
+		mixedWriter := multipart.NewWriter(&mixed)
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", contentType)
+
+		pw, err := mixedWriter.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = pw.Write(content)
+		if err != nil {
+			return nil, err
+		}
+
+		err = writeMailAttachment(mixedWriter, "text/calendar; charset=UTF-8; method=PUBLISH", "event.ics", CalendarEvent(info, message, now))
+		if err != nil {
+			return nil, err
+		}
+
+		err = mixedWriter.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		content = mixed.Bytes()
+		contentType = fmt.Sprintf("multipart/mixed; boundary=\"%s\"", mixedWriter.Boundary())
+	}
+
+	messageId, err := m.messageId()
+	if err != nil {
+		return nil, err
+	}
+
+	var res bytes.Buffer
+
+	fmt.Fprintf(&res, "From: %s\r\n", m.SenderAdress)
+	fmt.Fprintf(&res, "To: %s\r\n", recipientAddress)
+	fmt.Fprintf(&res, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", m.subject(info)))
+	fmt.Fprintf(&res, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&res, "Message-ID: %s\r\n", messageId)
+	res.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&res, "Content-Type: %s\r\n", contentType)
+	res.WriteString("\r\n")
+	res.Write(content)
+
+	return res.Bytes(), nil
+}
+
+func writeMailPart(mw *multipart.Writer, contentType string, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	pw, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	qw := quotedprintable.NewWriter(pw)
+
+	_, err = qw.Write([]byte(content))
+	if err != nil {
+		return err
+	}
 
-	msg := fmt.Sprintf("From: %s\r\n", m.SenderAdress)
-	msg += fmt.Sprintf("To: %s\r\n", recipientAddress)
-	msg += fmt.Sprintf("Subject: %s\r\n", m.Subject)
-	msg += "Content-Type: text/plain; charset=\"UTF-8\"\r\n"
-	msg += "\r\n"
-	msg += message
+	return qw.Close()
+}
+
+func writeMailAttachment(mw *multipart.Writer, contentType string, fileName string, content string) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+
+	pw, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+
+	// Lines of base64 encoded content must not be longer than 76 characters (RFC 2045)
+	for len(encoded) > 76 {
+		_, err = pw.Write([]byte(encoded[:76] + "\r\n"))
+		if err != nil {
+			return err
+		}
+
+		encoded = encoded[76:]
+	}
+
+	_, err = pw.Write([]byte(encoded + "\r\n"))
+
+	return err
+}
+
+func mailHtml(message string) string {
+	escaped := strings.ReplaceAll(html.EscapeString(message), "\n", "<br>\r\n")
+
+	return "<!DOCTYPE html>\r\n<html>\r\n<head><meta charset=\"UTF-8\"></head>\r\n<body>\r\n<p>" + escaped + "</p>\r\n</body>\r\n</html>\r\n"
+}
+
+// messageId creates a unique Message-ID which uses the domain of the sender address
+func (m *mailNotifier) messageId() (string, error) {
+	random := make([]byte, 16)
+
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	domain := m.Host
+	at := strings.LastIndex(m.SenderAdress, "@")
+	if at >= 0 {
+		domain = m.SenderAdress[at+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random), domain), nil
+}
+
+// loginAuth implements the LOGIN authentication mechanism which is not offered by net/smtp. Like
+// smtp.PlainAuth it refuses to send the password over an unencrypted connection to another host.
+type loginAuth struct {
+	user     string
+	password string
+	host     string
+}
+
+func (l *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+
+	if server.Name != l.host {
+		return "", nil, errors.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (l *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	prompt := strings.ToLower(string(fromServer))
+
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(l.user), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(l.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge '%s'", string(fromServer))
+	}
+}
 
-	auth := smtp.PlainAuth("", m.SenderAdress, m.Password, m.Host)
-	return smtp.SendMail(fmt.Sprintf("%s:%d", m.Host, m.Port), auth, m.SenderAdress, to, []byte(msg))
+func isLocalhost(name string) bool {
+	return (name == "localhost") || (name == "127.0.0.1") || (name == "::1")
 }
@@ -0,0 +1,480 @@
+package sms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"notifier/repo"
+	"notifier/tools"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const smtpTestUser = "sender@example.com"
+const smtpTestPassword = "geheim"
+
+// smtpStandIn is a minimal SMTP server which supports STARTTLS, implicit TLS and the authentication
+// methods PLAIN, LOGIN and CRAM-MD5. It stores the last message which was received.
+type smtpStandIn struct {
+	listener net.Listener
+	tlsConf  *tls.Config
+	implicit bool
+	mutex    sync.Mutex
+	data     []byte
+	authUsed string
+	usedTls  bool
+}
+
+func newTestCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func newSmtpStandIn(t *testing.T, tlsConf *tls.Config, implicit bool) *smtpStandIn {
+	var l net.Listener
+	var err error
+
+	if implicit {
+		l, err = tls.Listen("tcp", "127.0.0.1:0", tlsConf)
+	} else {
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	res := &smtpStandIn{listener: l, tlsConf: tlsConf, implicit: implicit}
+	go res.accept()
+
+	return res
+}
+
+func (s *smtpStandIn) port() uint16 {
+	return uint16(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *smtpStandIn) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.serve(conn)
+	}
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	usedTls := s.implicit
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 127.0.0.1 ESMTP stand-in")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			if (s.tlsConf != nil) && !usedTls {
+				tp.PrintfLine("250-127.0.0.1")
+				tp.PrintfLine("250-STARTTLS")
+			} else {
+				tp.PrintfLine("250-127.0.0.1")
+			}
+			tp.PrintfLine("250 AUTH PLAIN LOGIN CRAM-MD5")
+		case "STARTTLS":
+			tp.PrintfLine("220 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConf)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			usedTls = true
+		case "AUTH":
+			if s.authenticate(tp, arg) {
+				tp.PrintfLine("235 Authentication successful")
+			} else {
+				tp.PrintfLine("535 Authentication failed")
+			}
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+
+			s.mutex.Lock()
+			s.data = data
+			s.usedTls = usedTls
+			s.mutex.Unlock()
+
+			tp.PrintfLine("250 Queued")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func (s *smtpStandIn) authenticate(tp *textproto.Conn, arg string) bool {
+	mech, initial, _ := strings.Cut(arg, " ")
+	mech = strings.ToUpper(mech)
+
+	s.mutex.Lock()
+	s.authUsed = mech
+	s.mutex.Unlock()
+
+	readResponse := func(challenge string) string {
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+		line, _ := tp.ReadLine()
+		resp, _ := base64.StdEncoding.DecodeString(line)
+		return string(resp)
+	}
+
+	switch mech {
+	case "PLAIN":
+		resp, _ := base64.StdEncoding.DecodeString(initial)
+		return string(resp) == "\x00"+smtpTestUser+"\x00"+smtpTestPassword
+	case "LOGIN":
+		user := readResponse("Username:")
+		password := readResponse("Password:")
+		return (user == smtpTestUser) && (password == smtpTestPassword)
+	case "CRAM-MD5":
+		challenge := "<1234.5678@127.0.0.1>"
+		d := hmac.New(md5.New, []byte(smtpTestPassword))
+		d.Write([]byte(challenge))
+		return readResponse(challenge) == smtpTestUser+" "+hex.EncodeToString(d.Sum(nil))
+	default:
+		return false
+	}
+}
+
+func (s *smtpStandIn) received() ([]byte, string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.data, s.authUsed, s.usedTls
+}
+
+func newTestMailNotifier(s *smtpStandIn, pool *x509.CertPool) *mailNotifier {
+	res := NewMailNotifier("127.0.0.1", s.port(), smtpTestUser, smtpTestPassword)
+	res.TlsConfig = &tls.Config{RootCAs: pool}
+	res.Timeout = 5 * time.Second
+
+	return res
+}
+
+func TestMailSenderMessage(t *testing.T) {
+	standIn := newSmtpStandIn(t, nil, false)
+	defer standIn.listener.Close()
+
+	sender := newTestMailNotifier(standIn, nil)
+	sender.Security = MailSecurityNone
+	sender.SetSubject("Erinnerung für Müller")
+
+	err := sender.Send(context.Background(), "recipient@example.com", "Termin <morgen>\num 10 Uhr", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	data, authUsed, _ := standIn.received()
+	if authUsed != "PLAIN" {
+		t.Errorf("Wrong authentication method: %s", authUsed)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("Message not wellformed: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if (err != nil) || (subject != "Erinnerung für Müller") || !strings.HasPrefix(msg.Header.Get("Subject"), "=?UTF-8?") {
+		t.Errorf("Subject not encoded correctly: %s", msg.Header.Get("Subject"))
+	}
+
+	_, err = msg.Header.Date()
+	if err != nil {
+		t.Errorf("Date header not wellformed: %v", err)
+	}
+
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("Wrong Message-ID: %s", msg.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if (err != nil) || (mediaType != "multipart/alternative") {
+		t.Fatalf("Wrong content type: %s", msg.Header.Get("Content-Type"))
+	}
+
+	parts := map[string]string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("Multipart body not wellformed: %v", err)
+		}
+
+		content, _ := io.ReadAll(p)
+		parts[strings.Split(p.Header.Get("Content-Type"), ";")[0]] = string(content)
+	}
+
+	if parts["text/plain"] != "Termin <morgen>\num 10 Uhr" {
+		t.Errorf("Wrong text part: %q", parts["text/plain"])
+	}
+
+	if !strings.Contains(parts["text/html"], "Termin &lt;morgen&gt;<br>") {
+		t.Errorf("Wrong HTML part: %q", parts["text/html"])
+	}
+}
+
+func TestMailSenderTls(t *testing.T) {
+	cert, pool := newTestCertificate(t)
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	tests := []struct {
+		implicit bool
+		security string
+		auth     string
+		expected string
+	}{
+		{false, MailSecurityStartTls, MailAuthLogin, "LOGIN"},
+		{true, MailSecurityTls, MailAuthCramMd5, "CRAM-MD5"},
+		{true, MailSecurityTls, MailAuthPlain, "PLAIN"},
+		{false, MailSecurityStartTls, MailAuthNone, ""},
+	}
+
+	for _, j := range tests {
+		t.Run(fmt.Sprintf("%s/%s", j.security, j.auth), func(t *testing.T) {
+			standIn := newSmtpStandIn(t, tlsConf, j.implicit)
+			defer standIn.listener.Close()
+
+			sender := newTestMailNotifier(standIn, pool)
+			sender.Security = j.security
+			sender.Auth = j.auth
+
+			err := sender.Send(context.Background(), "recipient@example.com", "test", &MessageInfo{})
+			if err != nil {
+				t.Fatalf("Sending failed: %v", err)
+			}
+
+			data, authUsed, usedTls := standIn.received()
+			if (len(data) == 0) || !usedTls || (authUsed != j.expected) {
+				t.Errorf("Wrong transmission: TLS %v, authentication %s", usedTls, authUsed)
+			}
+		})
+	}
+
+	standIn := newSmtpStandIn(t, nil, false)
+	defer standIn.listener.Close()
+
+	sender := newTestMailNotifier(standIn, pool)
+	err := sender.Send(context.Background(), "recipient@example.com", "test", &MessageInfo{})
+	if err == nil {
+		t.Errorf("Missing STARTTLS support not detected")
+	}
+
+	sender.Security = MailSecurityNone
+	sender.Password = "falsch"
+	err = sender.Send(context.Background(), "recipient@example.com", "test", &MessageInfo{})
+	if err == nil {
+		t.Errorf("Failed authentication not detected")
+	}
+}
+
+func TestMailSenderCalendar(t *testing.T) {
+	tools.SetDefaultTZ()
+
+	sender := NewMailNotifier("127.0.0.1", 25, smtpTestUser, smtpTestPassword)
+	sender.AttachCalendar = true
+
+	info := MessageInfo{
+		ReminderId:          tools.UUIDGen(),
+		ReminderDescription: "Zahnarzt, Dr. Müller; Praxis",
+		ReminderKind:        repo.OneShot,
+		EventTime:           time.Date(2026, 11, 3, 9, 30, 0, 0, time.UTC),
+	}
+
+	data, err := sender.buildMessage("recipient@example.com", "Morgen um 10:30", &info, time.Now())
+	if err != nil {
+		t.Fatalf("Building message failed: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("Message not wellformed: %v", err)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Wrong content type: %s", mediaType)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	first, _ := mr.NextPart()
+	if !strings.HasPrefix(first.Header.Get("Content-Type"), "multipart/alternative") {
+		t.Errorf("Wrong first part: %s", first.Header.Get("Content-Type"))
+	}
+
+	second, err := mr.NextPart()
+	if (err != nil) || !strings.HasPrefix(second.Header.Get("Content-Type"), "text/calendar") {
+		t.Fatalf("Calendar part missing")
+	}
+
+	raw, _ := io.ReadAll(second)
+	event, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+
+	expected := []string{
+		"BEGIN:VEVENT\r\n",
+		"UID:" + CalendarUid(info.ReminderId, info.EventTime) + "\r\n",
+		"DTSTART:20261103T093000Z\r\n",
+		"SUMMARY:Zahnarzt\\, Dr. Müller\\; Praxis\r\n",
+	}
+
+	for _, j := range expected {
+		if !strings.Contains(string(event), j) {
+			t.Errorf("'%s' not found in event: %s", j, string(event))
+		}
+	}
+
+	if CalendarUid(info.ReminderId, info.EventTime.In(tools.ClientTZ())) != CalendarUid(info.ReminderId, info.EventTime) {
+		t.Errorf("UID is not stable")
+	}
+
+	info.ReminderKind = repo.Anniversary
+	if !strings.Contains(CalendarEvent(&info, strings.Repeat("x", 200), time.Now()), "DTSTART;VALUE=DATE:2026110") {
+		t.Errorf("Anniversary is not an all day event")
+	}
+
+	for _, j := range strings.Split(CalendarEvent(&info, strings.Repeat("ä", 100), time.Now()), "\r\n") {
+		if len(j) > icalMaxLineLen {
+			t.Errorf("Line not folded: %s", j)
+		}
+	}
+
+	sender.AttachCalendar = false
+	data, _ = sender.buildMessage("recipient@example.com", "test", &info, time.Now())
+	if strings.Contains(string(data), "text/calendar") {
+		t.Errorf("Calendar attached although turned off")
+	}
+}
+
+func TestMailSubjectOptions(t *testing.T) {
+	sender := NewMailNotifier("localhost", 25, "notifier@example.com", "")
+	sender.SetSubject("Benachrichtigung")
+
+	info := MessageInfo{ReminderDescription: "Zahnarzt"}
+	if sender.subject(&info) != "Benachrichtigung" {
+		t.Errorf("Global subject not used: %s", sender.subject(&info))
+	}
+
+	info.ReminderOptions = map[string]string{OptionSubjectFromDescription: "true"}
+	if sender.subject(&info) != "Zahnarzt" {
+		t.Errorf("Description not used as subject: %s", sender.subject(&info))
+	}
+
+	info.ReminderOptions[OptionSubject] = "Termin"
+	info.RecipientOptions = map[string]string{OptionSubjectPrefix: "[Familie]"}
+	if sender.subject(&info) != "[Familie] Termin" {
+		t.Errorf("Wrong subject: %s", sender.subject(&info))
+	}
+}
+
+func TestMailSenderProbe(t *testing.T) {
+	standIn := newSmtpStandIn(t, nil, false)
+	defer standIn.listener.Close()
+
+	sender := newTestMailNotifier(standIn, nil)
+	sender.Security = MailSecurityNone
+
+	health := ProbeSender(context.Background(), TypeMail, sender, NewSendTimeouts(nil, time.Second))
+	if !health.Probed || !health.Healthy {
+		t.Errorf("Probe failed: %v", health)
+	}
+
+	data, authUsed, _ := standIn.received()
+	if (authUsed != "PLAIN") || (len(data) != 0) {
+		t.Errorf("Probe did not authenticate or sent a message: %s, %d bytes", authUsed, len(data))
+	}
+
+	sender.Password = "falsch"
+	health = ProbeSender(context.Background(), TypeMail, sender, NewSendTimeouts(nil, time.Second))
+	if health.Healthy || (health.Error == "") {
+		t.Errorf("Wrong credentials not detected: %v", health)
+	}
+
+	health = ProbeSender(context.Background(), TypeDummy, NewDummySender(), NewSendTimeouts(nil, time.Second))
+	if health.Probed || !health.Healthy {
+		t.Errorf("Sender without probe reported as probed: %v", health)
+	}
+
+	// Address types without a sender are left out
+	addrBook := NewDBAddressBook(nil, nil)
+	addrBook.AddSender(TypeMail, sender)
+	addrBook.AddSender(TypeDummy, NewDummySender())
+	addrBook.AddSender(TypeIFTTT, nil)
+
+	all := ProbeAllSenders(context.Background(), addrBook, NewSendTimeouts(nil, time.Second))
+	if (len(all) != 2) || (all[0].AddrType != TypeDummy) || (all[1].AddrType != TypeMail) {
+		t.Errorf("Wrong results: %v", all)
+	}
+}
@@ -0,0 +1,114 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"notifier/tools"
+	"os"
+	"strings"
+)
+
+const envMatrixHomeserver = "MN_MATRIX_HOMESERVER"
+const envMatrixToken = "MN_MATRIX_TOKEN"
+
+type matrixMessage struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+}
+
+// MatrixSender posts m.room.message events to a Matrix room. The address of a recipient is the id of
+// the room.
+type MatrixSender struct {
+	Homeserver  string
+	AccessToken string
+	Client      *http.Client
+}
+
+func NewMatrixSender(homeserver string, token string, c *http.Client) *MatrixSender {
+	return &MatrixSender{
+		Homeserver:  strings.TrimSuffix(homeserver, "/"),
+		AccessToken: token,
+		Client:      c,
+	}
+}
+
+func NewMatrixSenderFromEnvironment() (*MatrixSender, error) {
+	homeserver, ok := os.LookupEnv(envMatrixHomeserver)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envMatrixHomeserver)
+	}
+
+	token, ok := os.LookupEnv(envMatrixToken)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envMatrixToken)
+	}
+
+	client, err := tools.MakeCustomHttpClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom HTTP client object: %v", err)
+	}
+
+	return NewMatrixSender(homeserver, token, client), nil
+}
+
+func (m *MatrixSender) GetName() string {
+	return TypeMatrix
+}
+
+// transactionId returns the id which the homeserver uses to detect duplicate requests. It is derived
+// from the notification id and the message. This way a retry of the warner does not post the message
+// again if the homeserver has already received it. A changed message, e.g. the rest of a partially
+// delivered one, gets a new id. Otherwise the homeserver would drop it.
+func transactionId(info *MessageInfo, message string) string {
+	if info.NotificationId == nil {
+		return "mn-" + tools.UUIDGen().String()
+	}
+
+	hash := sha256.Sum256([]byte(message))
+
+	return "mn-" + info.NotificationId.String() + "-" + hex.EncodeToString(hash[:8])
+}
+
+func (m *MatrixSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	matrixMsg := matrixMessage{
+		MsgType: "m.text",
+		Body:    message,
+	}
+
+	body, err := json.Marshal(&matrixMsg)
+	if err != nil {
+		return err
+	}
+
+	requestUrl := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", m.Homeserver, url.PathEscape(recipientAddress), url.PathEscape(transactionId(info, message)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, requestUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.AccessToken)
+
+	res, err := m.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Ignore body
+	io.ReadAll(res.Body)
+
+	if (res.StatusCode < 200) || (res.StatusCode >= 300) {
+		return fmt.Errorf("server responded with error code %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"notifier/tools"
+	"strings"
+	"testing"
+)
+
+func TestMatrixSender(t *testing.T) {
+	var got matrixMessage
+	paths := []string{}
+	var gotMethod, gotAuth string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotAuth = r.Header.Get("Authorization")
+		paths = append(paths, r.URL.EscapedPath())
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"event_id":"$abc"}`))
+	}))
+	defer server.Close()
+
+	sender := NewMatrixSender(server.URL+"/", "secret", server.Client())
+	info := MessageInfo{
+		NotificationId: tools.UUIDGen(),
+	}
+
+	// A retry of the same notification has to use the same transaction id
+	for range 2 {
+		err := sender.Send(context.Background(), "!room:example.org", "Hallo", &info)
+		if err != nil {
+			t.Fatalf("Sending failed: %v", err)
+		}
+	}
+
+	expectedPrefix := "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/mn-" + info.NotificationId.String() + "-"
+	if !strings.HasPrefix(paths[0], expectedPrefix) || (paths[1] != paths[0]) {
+		t.Errorf("Wrong paths: %v", paths)
+	}
+
+	// A different message of the same notification, e.g. the rest of a partially delivered message,
+	// must not be dropped as a duplicate
+	err := sender.Send(context.Background(), "!room:example.org", "(...) Welt", &info)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if !strings.HasPrefix(paths[2], expectedPrefix) || (paths[2] == paths[0]) {
+		t.Errorf("Changed message uses the same transaction id: %v", paths)
+	}
+
+	if (gotMethod != http.MethodPut) || (gotAuth != "Bearer secret") {
+		t.Errorf("Wrong request: %s %s", gotMethod, gotAuth)
+	}
+
+	if (got.MsgType != "m.text") || (got.Body != "(...) Welt") {
+		t.Errorf("Wrong message: %v", got)
+	}
+}
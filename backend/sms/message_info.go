@@ -0,0 +1,33 @@
+package sms
+
+import (
+	"notifier/repo"
+	"notifier/tools"
+	"time"
+)
+
+// MessageInfo describes the context in which a message is sent. All fields which are not known are
+// left at their zero value, e.g. messages sent through the send endpoint do not belong to a reminder.
+type MessageInfo struct {
+	RecipientId         *tools.UUID
+	NotificationId      *tools.UUID
+	ReminderId          *tools.UUID
+	ReminderDescription string
+	ReminderKind        repo.ReminderType
+	Priority            repo.Priority
+	// EventTime is the occurrence of the reminder which the message warns about
+	EventTime   time.Time
+	WarningTime time.Time
+	// RecipientOptions are the options of the channel which is used to reach the recipient
+	RecipientOptions map[string]string
+	// ChannelOwnerId is the id of the recipient to which this channel belongs. It differs from RecipientId
+	// if the message was redirected to a substitute.
+	ChannelOwnerId *tools.UUID
+	// ReminderOptions are the options of the reminder
+	ReminderOptions map[string]string
+	// PendingParts is the number of parts of the message which are sent one after the other through the
+	// same channel beginning with this one. FollowUp is true for all of these parts but the first one.
+	// This allows to check limits once for all parts.
+	PendingParts int
+	FollowUp     bool
+}
@@ -1,6 +1,7 @@
 package sms
 
 import (
+	"context"
 	"notifier/mqtt"
 	"time"
 )
@@ -25,8 +26,33 @@ func (m *MqttMessageSender) SetQos(qOs byte) {
 	m.qOs = qOs
 }
 
-func (m *MqttMessageSender) Send(recipientAddress string, message string) error {
-	return m.sender.PublishWhenConnected(recipientAddress, []byte(message), m.qOs, m.timeOut)
+// Send publishes the message to the topic given by recipientAddress. The options of the recipient
+// can override the global QoS and request that the message is retained by the broker.
+func (m *MqttMessageSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	qOs := m.qOs
+
+	val, ok := info.RecipientOptions[OptionQos]
+	if ok {
+		q, err := parseQos(val)
+		if err != nil {
+			return err
+		}
+
+		qOs = q
+	}
+
+	retain := boolOption(info.RecipientOptions, OptionRetain)
+
+	return m.sender.PublishWhenConnected(ctx, recipientAddress, []byte(message), qOs, retain, m.timeOut)
+}
+
+// Probe reports whether the connection to the broker is currently up
+func (m *MqttMessageSender) Probe(ctx context.Context) error {
+	if !m.sender.IsConnected() {
+		return mqtt.ErrNotConnected
+	}
+
+	return nil
 }
 
 func (m *MqttMessageSender) GetName() string {
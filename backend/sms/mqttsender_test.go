@@ -0,0 +1,38 @@
+package sms
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recordingPublisher struct {
+	qos    byte
+	retain bool
+}
+
+func (r *recordingPublisher) IsConnected() bool {
+	return true
+}
+
+func (r *recordingPublisher) PublishWhenConnected(ctx context.Context, topic string, payload []byte, qos byte, retain bool, timeout time.Duration) error {
+	r.qos = qos
+	r.retain = retain
+	return nil
+}
+
+func TestMqttSenderOptions(t *testing.T) {
+	publisher := &recordingPublisher{}
+	sender := NewMqttMessageSender(publisher, time.Second)
+
+	err := sender.Send(context.Background(), "test/topic", "hallo", &MessageInfo{})
+	if (err != nil) || (publisher.qos != 1) || publisher.retain {
+		t.Errorf("Default options not used: qos %d, retain %t", publisher.qos, publisher.retain)
+	}
+
+	info := MessageInfo{RecipientOptions: map[string]string{OptionQos: "2", OptionRetain: "true"}}
+	err = sender.Send(context.Background(), "test/topic", "hallo", &info)
+	if (err != nil) || (publisher.qos != 2) || !publisher.retain {
+		t.Errorf("Recipient options not used: qos %d, retain %t", publisher.qos, publisher.retain)
+	}
+}
@@ -0,0 +1,222 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"notifier/repo"
+	"notifier/tools"
+	"os"
+	"strings"
+)
+
+const envNtfyServer = "MN_NTFY_SERVER"
+const envNtfyToken = "MN_NTFY_TOKEN"
+const envNtfyUser = "MN_NTFY_USER"
+const envNtfyPassword = "MN_NTFY_PASSWORD"
+const envNtfyTags = "MN_NTFY_TAGS"
+const envNtfyClickUrl = "MN_NTFY_CLICK_URL"
+
+// The placeholder in the click URL which is replaced by the id of the reminder
+const ntfyReminderPlaceholder = "{reminder}"
+
+var ntfyPriorities = map[repo.Priority]int{
+	repo.PriorityLow:    2,
+	repo.PriorityNormal: 3,
+	repo.PriorityHigh:   4,
+	repo.PriorityUrgent: 5,
+}
+
+var ntfyKindTags = map[repo.ReminderType]string{
+	repo.Anniversary: "anniversary",
+	repo.OneShot:     "one_shot",
+	repo.Monthly:     "monthly",
+	repo.Weekly:      "weekly",
+}
+
+type ntfyMessage struct {
+	Topic    string   `json:"topic"`
+	Message  string   `json:"message"`
+	Title    string   `json:"title,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Click    string   `json:"click,omitempty"`
+}
+
+// NtfySender publishes messages to topics of an ntfy server. The address of a recipient is either the
+// name of a topic on the configured server or the full URL of a topic.
+type NtfySender struct {
+	ServerUrl string
+	Token     string
+	User      string
+	Password  string
+	Tags      []string
+	ClickUrl  string
+	Client    *http.Client
+}
+
+func NewNtfySender(serverUrl string, c *http.Client) *NtfySender {
+	return &NtfySender{
+		ServerUrl: strings.TrimSuffix(serverUrl, "/"),
+		Tags:      []string{},
+		Client:    c,
+	}
+}
+
+func NewNtfySenderFromEnvironment() (*NtfySender, error) {
+	serverUrl, ok := os.LookupEnv(envNtfyServer)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envNtfyServer)
+	}
+
+	client, err := tools.MakeCustomHttpClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom HTTP client object: %v", err)
+	}
+
+	res := NewNtfySender(serverUrl, client)
+
+	token, ok := os.LookupEnv(envNtfyToken)
+	if ok {
+		res.Token = token
+	} else {
+		user, okUser := os.LookupEnv(envNtfyUser)
+		password, okPassword := os.LookupEnv(envNtfyPassword)
+		if okUser && okPassword {
+			res.User = user
+			res.Password = password
+		}
+	}
+
+	tags, ok := os.LookupEnv(envNtfyTags)
+	if ok {
+		for _, j := range strings.Split(tags, ",") {
+			if t := strings.TrimSpace(j); t != "" {
+				res.Tags = append(res.Tags, t)
+			}
+		}
+	}
+
+	clickUrl, ok := os.LookupEnv(envNtfyClickUrl)
+	if ok {
+		res.ClickUrl = clickUrl
+	}
+
+	return res, nil
+}
+
+func (n *NtfySender) GetName() string {
+	return TypeNtfy
+}
+
+// splitAddress returns the URL to which the message has to be published and the name of the topic. JSON
+// messages can only be published to the root of an ntfy server. If a full URL names a topic on the
+// configured server, the message is published to the configured URL, which may contain a path, e.g.
+// if ntfy runs behind a reverse proxy. Otherwise it is published to the root of the named server and
+// the whole path is used as the topic.
+func (n *NtfySender) splitAddress(recipientAddress string) (string, string, error) {
+	if !strings.HasPrefix(recipientAddress, "http://") && !strings.HasPrefix(recipientAddress, "https://") {
+		return n.ServerUrl, recipientAddress, nil
+	}
+
+	target, err := url.Parse(recipientAddress)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to parse '%s': %v", recipientAddress, err)
+	}
+
+	serverUrl := target.Scheme + "://" + target.Host
+	path := target.Path
+
+	configured, err := url.Parse(n.ServerUrl)
+	if (err == nil) && n.isConfiguredServer(serverUrl) && strings.HasPrefix(path, configured.Path+"/") {
+		serverUrl = n.ServerUrl
+		path = strings.TrimPrefix(path, configured.Path)
+	}
+
+	topic := strings.Trim(path, "/")
+	if topic == "" {
+		return "", "", fmt.Errorf("no topic found in '%s'", recipientAddress)
+	}
+
+	return serverUrl, topic, nil
+}
+
+// isConfiguredServer returns true if serverUrl has the same scheme and host as the configured server
+func (n *NtfySender) isConfiguredServer(serverUrl string) bool {
+	target, err := url.Parse(serverUrl)
+	if err != nil {
+		return false
+	}
+
+	configured, err := url.Parse(n.ServerUrl)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(target.Scheme, configured.Scheme) && strings.EqualFold(target.Host, configured.Host)
+}
+
+func (n *NtfySender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	serverUrl, topic, err := n.splitAddress(recipientAddress)
+	if err != nil {
+		return err
+	}
+
+	ntfyMsg := ntfyMessage{
+		Topic:    topic,
+		Message:  message,
+		Title:    info.ReminderDescription,
+		Priority: ntfyPriorities[info.Priority],
+		Tags:     append([]string{}, n.Tags...),
+	}
+
+	kindTag, ok := ntfyKindTags[info.ReminderKind]
+	if ok {
+		ntfyMsg.Tags = append(ntfyMsg.Tags, kindTag)
+	}
+
+	if (n.ClickUrl != "") && (info.ReminderId != nil) {
+		ntfyMsg.Click = strings.ReplaceAll(n.ClickUrl, ntfyReminderPlaceholder, info.ReminderId.String())
+	}
+
+	body, err := json.Marshal(&ntfyMsg)
+	if err != nil {
+		return err
+	}
+
+	// Publishing as JSON allows to use non ASCII characters in the title and the tags
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, serverUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	// Addresses may name any server. The credentials are only meant for the configured one.
+	if n.isConfiguredServer(serverUrl) {
+		if n.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+n.Token)
+		} else if n.User != "" {
+			req.SetBasicAuth(n.User, n.Password)
+		}
+	}
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Ignore body
+	io.ReadAll(res.Body)
+
+	if (res.StatusCode < 200) || (res.StatusCode >= 300) {
+		return fmt.Errorf("server responded with error code %d", res.StatusCode)
+	}
+
+	return nil
+}
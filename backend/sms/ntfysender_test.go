@@ -0,0 +1,94 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"notifier/repo"
+	"notifier/tools"
+	"testing"
+)
+
+func TestNtfySender(t *testing.T) {
+	var got ntfyMessage
+	var gotPath, gotAuth string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	sender := NewNtfySender(server.URL+"/", server.Client())
+	sender.Token = "tk_test"
+	sender.Tags = []string{"bell"}
+	sender.ClickUrl = "https://notifier.example.org/reminder/{reminder}"
+
+	reminderId := tools.UUIDGen()
+	info := MessageInfo{
+		ReminderId:          reminderId,
+		ReminderDescription: "Geburtstag",
+		ReminderKind:        repo.Anniversary,
+		Priority:            repo.PriorityUrgent,
+	}
+
+	err := sender.Send(context.Background(), "family", "Heute", &info)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (gotPath != "/") || (gotAuth != "Bearer tk_test") {
+		t.Errorf("Wrong request: %s %s", gotPath, gotAuth)
+	}
+
+	if (got.Topic != "family") || (got.Message != "Heute") || (got.Title != "Geburtstag") || (got.Priority != 5) {
+		t.Errorf("Wrong message: %v", got)
+	}
+
+	if (len(got.Tags) != 2) || (got.Tags[1] != "anniversary") {
+		t.Errorf("Wrong tags: %v", got.Tags)
+	}
+
+	if got.Click != "https://notifier.example.org/reminder/"+reminderId.String() {
+		t.Errorf("Wrong click action: %s", got.Click)
+	}
+
+	sender = NewNtfySender("https://unused.example.org", server.Client())
+	sender.User = "user"
+	sender.Password = "pw"
+
+	err = sender.Send(context.Background(), server.URL+"/sub/alerts", "test", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (gotPath != "/") || (got.Topic != "sub/alerts") || (got.Priority != 3) {
+		t.Errorf("Full topic URL not handled correctly: %s %v", gotPath, got)
+	}
+
+	// The credentials must not be sent to another server
+	if gotAuth != "" {
+		t.Errorf("Credentials sent to a server which is not configured: %s", gotAuth)
+	}
+
+	// The configured server is reachable under a subpath
+	sender = NewNtfySender(server.URL+"/ntfy", server.Client())
+	sender.User = "user"
+	sender.Password = "pw"
+
+	err = sender.Send(context.Background(), server.URL+"/ntfy/alerts", "test", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (gotPath != "/ntfy") || (got.Topic != "alerts") {
+		t.Errorf("Topic URL with subpath not handled correctly: %s %v", gotPath, got)
+	}
+
+	user, pw, ok := (&http.Request{Header: http.Header{"Authorization": {gotAuth}}}).BasicAuth()
+	if !ok || (user != "user") || (pw != "pw") {
+		t.Errorf("Basic auth not used")
+	}
+}
@@ -0,0 +1,88 @@
+package sms
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Options of a recipient. They apply to the channel for which they are specified.
+const OptionSubjectPrefix = "subject_prefix"
+const OptionQos = "qos"
+const OptionRetain = "retain"
+
+// Options of a reminder. They apply to all notifications of the reminder.
+const OptionSubject = "subject"
+const OptionSubjectFromDescription = "subject_from_description"
+
+// optionValidator returns an error if the value is not allowed for the option
+type optionValidator func(value string) error
+
+func validateAny(value string) error {
+	return nil
+}
+
+func validateBool(value string) error {
+	_, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("'%s' is not a boolean", value)
+	}
+
+	return nil
+}
+
+func validateQos(value string) error {
+	_, err := parseQos(value)
+	return err
+}
+
+var recipientOptions = map[string]optionValidator{
+	OptionSubjectPrefix: validateAny,
+	OptionQos:           validateQos,
+	OptionRetain:        validateBool,
+}
+
+var reminderOptions = map[string]optionValidator{
+	OptionSubject:                validateAny,
+	OptionSubjectFromDescription: validateBool,
+}
+
+func validateOptions(options map[string]string, known map[string]optionValidator) error {
+	for k, v := range options {
+		validator, ok := known[k]
+		if !ok {
+			return fmt.Errorf("unknown option '%s'", k)
+		}
+
+		err := validator(v)
+		if err != nil {
+			return fmt.Errorf("illegal value for option '%s': %v", k, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateRecipientOptions checks the options of a recipient or of one of its fallback channels
+func ValidateRecipientOptions(options map[string]string) error {
+	return validateOptions(options, recipientOptions)
+}
+
+// ValidateReminderOptions checks the options of a reminder
+func ValidateReminderOptions(options map[string]string) error {
+	return validateOptions(options, reminderOptions)
+}
+
+func parseQos(value string) (byte, error) {
+	qos, err := strconv.ParseUint(value, 10, 8)
+	if (err != nil) || (qos > 2) {
+		return 0, fmt.Errorf("'%s' is not a valid QoS", value)
+	}
+
+	return byte(qos), nil
+}
+
+// boolOption returns the value of a boolean option. Missing or malformed values are treated as false.
+func boolOption(options map[string]string, key string) bool {
+	val, err := strconv.ParseBool(options[key])
+	return (err == nil) && val
+}
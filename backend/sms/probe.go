@@ -0,0 +1,84 @@
+package sms
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ProbingSender is implemented by senders which are able to check their configuration without
+// sending a message, e.g. by connecting and authenticating to a server
+type ProbingSender interface {
+	Probe(ctx context.Context) error
+}
+
+// SenderHealth is the result of probing the sender of an address type. Probed is false if the
+// sender does not support probes. In this case Healthy is true.
+type SenderHealth struct {
+	AddrType string `json:"addr_type"`
+	Sender   string `json:"sender"`
+	Probed   bool   `json:"probed"`
+	Healthy  bool   `json:"healthy"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ProbeSender checks the sender within the given timeouts
+func ProbeSender(ctx context.Context, addrType string, s SmsSender, timeouts *SendTimeouts) SenderHealth {
+	res := SenderHealth{
+		AddrType: addrType,
+		Sender:   s.GetName(),
+		Healthy:  true,
+	}
+
+	prober, ok := s.(ProbingSender)
+	if !ok {
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeouts.GetTimeout(s.GetName()))
+	defer cancel()
+
+	res.Probed = true
+
+	err := prober.Probe(ctx)
+	if err != nil {
+		res.Healthy = false
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// ProbeAllSenders probes the senders of all address types in parallel. The result is sorted by
+// address type. Address types without a sender are left out.
+func ProbeAllSenders(ctx context.Context, addrBook SmsAddressBook, timeouts *SendTimeouts) []SenderHealth {
+	res := []SenderHealth{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, j := range addrBook.GetAllAddressTypes() {
+		sender := addrBook.GetSender(j)
+		if sender == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			health := ProbeSender(ctx, j, sender, timeouts)
+
+			mutex.Lock()
+			res = append(res, health)
+			mutex.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	slices.SortFunc(res, func(a, b SenderHealth) int {
+		return strings.Compare(a.AddrType, b.AddrType)
+	})
+
+	return res
+}
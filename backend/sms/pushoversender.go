@@ -0,0 +1,123 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"notifier/repo"
+	"notifier/tools"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const envPushoverToken = "MN_PUSHOVER_TOKEN"
+const envPushoverUrl = "MN_PUSHOVER_URL"
+const defaultPushoverUrl = "https://api.pushover.net/1/messages.json"
+
+// Pushover rejects messages which contain more than 1024 characters
+const pushoverMaxLength = 1024
+
+// Emergency messages are repeated by Pushover every pushoverRetry until they are acknowledged
+// or pushoverExpire has passed
+const pushoverEmergency = 2
+const pushoverRetry = 5 * time.Minute
+const pushoverExpire = 3 * time.Hour
+
+var pushoverPriorities = map[repo.Priority]int{
+	repo.PriorityLow:    -1,
+	repo.PriorityNormal: 0,
+	repo.PriorityHigh:   1,
+	repo.PriorityUrgent: pushoverEmergency,
+}
+
+// PushoverSender sends messages through the Pushover API. The address of a recipient is a Pushover user
+// or group key.
+type PushoverSender struct {
+	ApiUrl   string
+	AppToken string
+	Retry    time.Duration
+	Expire   time.Duration
+	Client   *http.Client
+}
+
+func NewPushoverSender(apiUrl string, appToken string, c *http.Client) *PushoverSender {
+	return &PushoverSender{
+		ApiUrl:   apiUrl,
+		AppToken: appToken,
+		Retry:    pushoverRetry,
+		Expire:   pushoverExpire,
+		Client:   c,
+	}
+}
+
+func NewPushoverSenderFromEnvironment() (*PushoverSender, error) {
+	token, ok := os.LookupEnv(envPushoverToken)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envPushoverToken)
+	}
+
+	apiUrl, ok := os.LookupEnv(envPushoverUrl)
+	if !ok {
+		apiUrl = defaultPushoverUrl
+	}
+
+	client, err := tools.MakeCustomHttpClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom HTTP client object: %v", err)
+	}
+
+	return NewPushoverSender(apiUrl, token, client), nil
+}
+
+func (p *PushoverSender) MaxMessageLength() MessageLimit {
+	return MessageLimit{GSM7: pushoverMaxLength, UCS2: pushoverMaxLength}
+}
+
+func (p *PushoverSender) GetName() string {
+	return TypePushover
+}
+
+func (p *PushoverSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	priority := pushoverPriorities[info.Priority]
+
+	form := url.Values{}
+	form.Set("token", p.AppToken)
+	form.Set("user", recipientAddress)
+	form.Set("message", message)
+	form.Set("priority", strconv.Itoa(priority))
+
+	if info.ReminderDescription != "" {
+		form.Set("title", info.ReminderDescription)
+	}
+
+	if priority == pushoverEmergency {
+		form.Set("retry", strconv.Itoa(int(p.Retry.Seconds())))
+		form.Set("expire", strconv.Itoa(int(p.Expire.Seconds())))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.ApiUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Ignore body
+	io.ReadAll(res.Body)
+
+	if (res.StatusCode < 200) || (res.StatusCode >= 300) {
+		return fmt.Errorf("server responded with error code %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package sms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"notifier/repo"
+	"testing"
+)
+
+func TestPushoverSender(t *testing.T) {
+	var got url.Values
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r.PostForm
+
+		if got.Get("token") != "app" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`{"status":1}`))
+	}))
+	defer server.Close()
+
+	sender := NewPushoverSender(server.URL, "app", server.Client())
+
+	info := MessageInfo{
+		ReminderDescription: "Medikament",
+		Priority:            repo.PriorityUrgent,
+	}
+
+	err := sender.Send(context.Background(), "userkey", "Jetzt einnehmen", &info)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (got.Get("user") != "userkey") || (got.Get("message") != "Jetzt einnehmen") || (got.Get("title") != "Medikament") {
+		t.Errorf("Wrong message: %v", got)
+	}
+
+	if (got.Get("priority") != "2") || (got.Get("retry") != "300") || (got.Get("expire") != "10800") {
+		t.Errorf("Emergency priority not set correctly: %v", got)
+	}
+
+	err = sender.Send(context.Background(), "userkey", "test", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (got.Get("priority") != "0") || got.Has("retry") || got.Has("title") {
+		t.Errorf("Normal priority not set correctly: %v", got)
+	}
+
+	sender.AppToken = "wrong"
+	err = sender.Send(context.Background(), "userkey", "test", &MessageInfo{})
+	if err == nil {
+		t.Errorf("Error status was not detected")
+	}
+}
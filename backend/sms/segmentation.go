@@ -0,0 +1,202 @@
+package sms
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Maximum length of a single SMS
+const SmsMaxGSM7 = 160
+const SmsMaxUCS2 = 70
+
+// MessageLimit describes the maximum length of a message. Messages which can be represented in the
+// GSM 7 bit default alphabet are measured in septets, all other messages in UTF-16 code units.
+type MessageLimit struct {
+	GSM7 int
+	UCS2 int
+}
+
+// SmsLimit is the limit of senders which deliver each message as a single SMS
+var SmsLimit = MessageLimit{GSM7: SmsMaxGSM7, UCS2: SmsMaxUCS2}
+
+// LengthLimitedSender is implemented by senders which are not able to transmit messages of arbitrary
+// length. Messages which are longer than the limit are split into parts before they are sent.
+type LengthLimitedSender interface {
+	MaxMessageLength() MessageLimit
+}
+
+// charLength returns the length of a character in septets or UTF-16 code units
+func charLength(c rune, gsm7 bool) int {
+	if !gsm7 {
+		return utf16.RuneLen(c)
+	}
+
+	_, ok := gsm7Extension[c]
+	if ok {
+		return 2
+	}
+
+	return 1
+}
+
+func textLength(text string, gsm7 bool) int {
+	res := 0
+
+	for _, j := range text {
+		res += charLength(j, gsm7)
+	}
+
+	return res
+}
+
+// SplitMessage splits a message which exceeds the limit into numbered parts like "(1/3) ...". The
+// message is split at word boundaries if possible. Messages which do not exceed the limit are
+// returned unchanged.
+func SplitMessage(message string, limit MessageLimit) []string {
+	gsm7 := IsGSM7(message)
+	maxLen := limit.UCS2
+	if gsm7 {
+		maxLen = limit.GSM7
+	}
+
+	if (maxLen <= 0) || (textLength(message, gsm7) <= maxLen) {
+		return []string{message}
+	}
+
+	// The space needed for the numbering depends on the number of parts. Start with the assumption
+	// that there are less than ten parts and repeat until the assumption holds.
+	partCount := 9
+	for {
+		prefixLen := len(numberingPrefix(partCount, partCount))
+		if maxLen-prefixLen < 1 {
+			return []string{message}
+		}
+
+		chunks := splitText(message, maxLen-prefixLen, gsm7)
+		if len(fmt.Sprint(len(chunks))) <= len(fmt.Sprint(partCount)) {
+			res := []string{}
+			for i, j := range chunks {
+				res = append(res, numberingPrefix(i+1, len(chunks))+j)
+			}
+
+			return res
+		}
+
+		partCount = partCount*10 + 9
+	}
+}
+
+// SplitForSender returns the parts in which the message has to be split in order to send it through
+// the given sender
+func SplitForSender(s SmsSender, message string) []string {
+	limited, ok := s.(LengthLimitedSender)
+	if !ok {
+		return []string{message}
+	}
+
+	return SplitMessage(message, limited.MaxMessageLength())
+}
+
+// SegmentCounter is implemented by senders which split messages internally, e.g. into concatenated
+// SMS. Segments returns the number of segments which are needed to send the message.
+type SegmentCounter interface {
+	Segments(message string) int
+}
+
+// CountSegments returns the number of segments which are needed to send the message through the given
+// sender. This is the number of parts the message is split into unless the sender splits the parts
+// further.
+func CountSegments(s SmsSender, message string) int {
+	parts := SplitForSender(s, message)
+
+	counter, ok := s.(SegmentCounter)
+	if !ok {
+		return len(parts)
+	}
+
+	res := 0
+	for _, j := range parts {
+		res += counter.Segments(j)
+	}
+
+	return res
+}
+
+func numberingPrefix(part int, total int) string {
+	return fmt.Sprintf("(%d/%d) ", part, total)
+}
+
+// splitText splits the text into chunks which are not longer than maxLen. Chunks end at whitespace
+// if possible. Words which are longer than maxLen are split.
+func splitText(text string, maxLen int, gsm7 bool) []string {
+	res := []string{}
+	current := []rune{}
+	currentLen := 0
+
+	flush := func() {
+		chunk := strings.TrimSpace(string(current))
+		if chunk != "" {
+			res = append(res, chunk)
+		}
+
+		current = []rune{}
+		currentLen = 0
+	}
+
+	for _, word := range splitWords(text) {
+		wordLen := textLength(string(word), gsm7)
+		trimmedLen := textLength(strings.TrimRightFunc(string(word), unicode.IsSpace), gsm7)
+
+		// Whitespace at the end of a chunk is removed. Therefore it does not count.
+		if currentLen+trimmedLen <= maxLen {
+			current = append(current, word...)
+			currentLen += wordLen
+			continue
+		}
+
+		flush()
+
+		if trimmedLen <= maxLen {
+			current = append(current, word...)
+			currentLen = wordLen
+			continue
+		}
+
+		for _, c := range word {
+			l := charLength(c, gsm7)
+			if currentLen+l > maxLen {
+				flush()
+			}
+
+			current = append(current, c)
+			currentLen += l
+		}
+	}
+
+	flush()
+
+	return res
+}
+
+// splitWords returns the words of the text. Each word contains the whitespace which follows it.
+func splitWords(text string) [][]rune {
+	res := [][]rune{}
+	current := []rune{}
+
+	for _, c := range text {
+		if !unicode.IsSpace(c) && (len(current) > 0) && unicode.IsSpace(current[len(current)-1]) {
+			res = append(res, current)
+			current = []rune{}
+		}
+
+		current = append(current, c)
+	}
+
+	if len(current) > 0 {
+		res = append(res, current)
+	}
+
+	return res
+}
@@ -0,0 +1,88 @@
+package sms
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	short := "Morgen ist Abholung der Biotonne"
+	parts := SplitMessage(short, SmsLimit)
+	if (len(parts) != 1) || (parts[0] != short) {
+		t.Errorf("Short message changed: %v", parts)
+	}
+
+	long := strings.Repeat("Wort ", 70)
+	parts = SplitMessage(long, SmsLimit)
+	if len(parts) != 3 {
+		t.Fatalf("Wrong number of parts: %d", len(parts))
+	}
+
+	for i, j := range parts {
+		if textLength(j, true) > SmsMaxGSM7 {
+			t.Errorf("Part %d is too long: %d", i, textLength(j, true))
+		}
+
+		if strings.HasSuffix(j, "Wor") || strings.Contains(j, "  ") {
+			t.Errorf("Part %d not split at a word boundary: '%s'", i, j)
+		}
+	}
+
+	if !strings.HasPrefix(parts[0], "(1/3) Wort") || !strings.HasPrefix(parts[2], "(3/3) Wort") {
+		t.Errorf("Parts not numbered: %v", parts)
+	}
+
+	// A single character outside of the GSM 7 bit alphabet switches to UCS-2
+	parts = SplitMessage(strings.Repeat("Ŵort ", 30), SmsLimit)
+	for i, j := range parts {
+		if textLength(j, false) > SmsMaxUCS2 {
+			t.Errorf("UCS-2 part %d is too long: %d", i, textLength(j, false))
+		}
+	}
+
+	if len(parts) != 3 {
+		t.Errorf("Wrong number of UCS-2 parts: %d", len(parts))
+	}
+
+	// Extension characters need two septets
+	parts = SplitMessage(strings.Repeat("€", 100), SmsLimit)
+	for i, j := range parts {
+		if textLength(j, true) > SmsMaxGSM7 {
+			t.Errorf("Part %d with extension characters is too long: %d", i, textLength(j, true))
+		}
+	}
+
+	if strings.Join(parts, "") != "(1/2) "+strings.Repeat("€", 77)+"(2/2) "+strings.Repeat("€", 23) {
+		t.Errorf("Long word not split correctly: %v", parts)
+	}
+
+	parts = SplitMessage(strings.Repeat("x", 2000), MessageLimit{GSM7: 20, UCS2: 20})
+	if (len(parts) != 200) || !strings.HasPrefix(parts[199], "(200/200) ") {
+		t.Errorf("Numbering with three digits not correct: %d parts", len(parts))
+	}
+
+	for i, j := range parts {
+		if len(j) > 20 {
+			t.Errorf("Part %d is too long: '%s'", i, j)
+		}
+	}
+}
+
+func TestSendSplitMessage(t *testing.T) {
+	sender := NewDummySender()
+	recorder := &failingSender{}
+
+	send := func(ctx context.Context, s SmsSender, recipientAddress string, message string, info *MessageInfo) error {
+		return recorder.Send(ctx, recipientAddress, message, info)
+	}
+
+	_, err := SendWithFallback(context.Background(), []Channel{{AddrType: TypeDummy, Address: "a", Sender: sender}}, strings.Repeat("Wort ", 70), &MessageInfo{}, send)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if len(recorder.received) != 3 {
+		t.Errorf("Message not split: %v", recorder.received)
+	}
+}
@@ -0,0 +1,121 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"notifier/tools"
+	"os"
+	"strings"
+)
+
+const envSignalUrl = "MN_SIGNAL_URL"
+const envSignalNumber = "MN_SIGNAL_NUMBER"
+const envSignalToken = "MN_SIGNAL_TOKEN"
+
+// signal-cli-rest-api expects group ids to be prefixed with this string
+const signalGroupPrefix = "group."
+
+type signalSendRequest struct {
+	Message    string   `json:"message"`
+	Number     string   `json:"number"`
+	Recipients []string `json:"recipients"`
+}
+
+// SignalSender sends messages through signal-cli-rest-api. The address of a recipient is either a
+// phone number or a group id of the form group.xxx. If the service is protected in the same way as
+// the local SMS sender a JWT can be configured which is sent in the X-Token header.
+type SignalSender struct {
+	ServiceUrl   string
+	SenderNumber string
+	Jwt          string
+	Client       *http.Client
+}
+
+func NewSignalSender(url string, senderNumber string, jwt string, c *http.Client) *SignalSender {
+	res := SignalSender{
+		ServiceUrl:   strings.TrimSuffix(url, "/"),
+		SenderNumber: normalizeSignalNumber(senderNumber),
+		Jwt:          jwt,
+		Client:       c,
+	}
+
+	return &res
+}
+
+func NewSignalSenderFromEnvironment() (*SignalSender, error) {
+	url, ok := os.LookupEnv(envSignalUrl)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envSignalUrl)
+	}
+
+	senderNumber, ok := os.LookupEnv(envSignalNumber)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envSignalNumber)
+	}
+
+	// The token is optional as signal-cli-rest-api does not offer authentication by itself
+	token, _ := os.LookupEnv(envSignalToken)
+
+	client, err := tools.MakeCustomHttpClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom HTTP client object: %v", err)
+	}
+
+	return NewSignalSender(url, senderNumber, token, client), nil
+}
+
+// normalizeSignalNumber adds the leading + to phone numbers which are specified in the same way as
+// for the local SMS sender, i.e. only by digits including the international access code
+func normalizeSignalNumber(address string) string {
+	if strings.HasPrefix(address, signalGroupPrefix) || strings.HasPrefix(address, "+") {
+		return address
+	}
+
+	return "+" + address
+}
+
+func (s *SignalSender) GetName() string {
+	return TypeSignal
+}
+
+func (s *SignalSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	sendReq := signalSendRequest{
+		Message:    message,
+		Number:     s.SenderNumber,
+		Recipients: []string{normalizeSignalNumber(recipientAddress)},
+	}
+
+	body, err := json.Marshal(&sendReq)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.ServiceUrl+"/v2/send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.Jwt != "" {
+		req.Header.Set("X-Token", s.Jwt)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Ignore body
+	io.ReadAll(res.Body)
+
+	if (res.StatusCode < 200) || (res.StatusCode >= 300) {
+		return fmt.Errorf("server responded with error code %d", res.StatusCode)
+	}
+
+	return nil
+}
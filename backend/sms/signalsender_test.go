@@ -0,0 +1,46 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignalSender(t *testing.T) {
+	var got signalSendRequest
+	var gotPath, gotToken string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotToken = r.Header.Get("X-Token")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sender := NewSignalSender(server.URL, "4915100000000", "jwt", server.Client())
+
+	err := sender.Send(context.Background(), "4917600000000", "Hallo", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (gotPath != "/v2/send") || (gotToken != "jwt") {
+		t.Errorf("Wrong request: %s %s", gotPath, gotToken)
+	}
+
+	if (got.Number != "+4915100000000") || (len(got.Recipients) != 1) || (got.Recipients[0] != "+4917600000000") || (got.Message != "Hallo") {
+		t.Errorf("Wrong message: %v", got)
+	}
+
+	err = sender.Send(context.Background(), "group.ZmFtaWx5", "Hallo", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if got.Recipients[0] != "group.ZmFtaWx5" {
+		t.Errorf("Group id was changed: %s", got.Recipients[0])
+	}
+}
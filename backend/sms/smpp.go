@@ -0,0 +1,387 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Command ids as defined in SMPP 3.4. Responses have the most significant bit set.
+const (
+	smppGenericNack         uint32 = 0x80000000
+	smppBindTransceiver     uint32 = 0x00000009
+	smppBindTransceiverResp uint32 = 0x80000009
+	smppSubmitSm            uint32 = 0x00000004
+	smppSubmitSmResp        uint32 = 0x80000004
+	smppDeliverSm           uint32 = 0x00000005
+	smppDeliverSmResp       uint32 = 0x80000005
+	smppUnbind              uint32 = 0x00000006
+	smppUnbindResp          uint32 = 0x80000006
+	smppEnquireLink         uint32 = 0x00000015
+	smppEnquireLinkResp     uint32 = 0x80000015
+)
+
+const smppResponseBit uint32 = 0x80000000
+const smppHeaderLen = 16
+const smppMaxPduLen = 64 * 1024
+const smppInterfaceVersion = 0x34
+const smppStatusOk uint32 = 0x00000000
+const smppStatusInvalidCommand uint32 = 0x00000003
+
+var ErrSmppConnectionClosed = errors.New("SMPP connection closed")
+
+// errSmppNotSent signals that a request could not be written to the connection. It is therefore safe
+// to repeat the request on a new connection.
+var errSmppNotSent = errors.New("SMPP request not sent")
+
+type smppPdu struct {
+	commandId uint32
+	status    uint32
+	sequence  uint32
+	body      []byte
+}
+
+func (p *smppPdu) marshal() []byte {
+	res := make([]byte, smppHeaderLen, smppHeaderLen+len(p.body))
+	binary.BigEndian.PutUint32(res[0:4], uint32(smppHeaderLen+len(p.body)))
+	binary.BigEndian.PutUint32(res[4:8], p.commandId)
+	binary.BigEndian.PutUint32(res[8:12], p.status)
+	binary.BigEndian.PutUint32(res[12:16], p.sequence)
+
+	return append(res, p.body...)
+}
+
+func readSmppPdu(r io.Reader) (*smppPdu, error) {
+	header := make([]byte, smppHeaderLen)
+
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if (length < smppHeaderLen) || (length > smppMaxPduLen) {
+		return nil, fmt.Errorf("illegal SMPP PDU length %d", length)
+	}
+
+	res := &smppPdu{
+		commandId: binary.BigEndian.Uint32(header[4:8]),
+		status:    binary.BigEndian.Uint32(header[8:12]),
+		sequence:  binary.BigEndian.Uint32(header[12:16]),
+		body:      make([]byte, length-smppHeaderLen),
+	}
+
+	_, err = io.ReadFull(r, res.body)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+type smppBodyWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *smppBodyWriter) cString(s string) *smppBodyWriter {
+	w.buf.WriteString(s)
+	w.buf.WriteByte(0)
+	return w
+}
+
+func (w *smppBodyWriter) octet(b byte) *smppBodyWriter {
+	w.buf.WriteByte(b)
+	return w
+}
+
+func (w *smppBodyWriter) octets(b []byte) *smppBodyWriter {
+	w.buf.Write(b)
+	return w
+}
+
+func (w *smppBodyWriter) bytes() []byte {
+	return w.buf.Bytes()
+}
+
+type smppBodyReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *smppBodyReader) cString() (string, error) {
+	end := bytes.IndexByte(r.data[r.pos:], 0)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated C-Octet string in SMPP PDU")
+	}
+
+	res := string(r.data[r.pos : r.pos+end])
+	r.pos += end + 1
+
+	return res, nil
+}
+
+func (r *smppBodyReader) octet() (byte, error) {
+	if r.pos >= len(r.data) {
+		return 0, fmt.Errorf("SMPP PDU too short")
+	}
+
+	r.pos++
+
+	return r.data[r.pos-1], nil
+}
+
+func (r *smppBodyReader) octets(n int) ([]byte, error) {
+	if r.pos+n > len(r.data) {
+		return nil, fmt.Errorf("SMPP PDU too short")
+	}
+
+	r.pos += n
+
+	return r.data[r.pos-n : r.pos], nil
+}
+
+// smppConn is a bound SMPP session. Requests can be sent concurrently. Responses are matched to
+// requests via their sequence numbers by a goroutine which reads all incoming PDUs. This goroutine
+// also answers requests from the SMSC.
+type smppConn struct {
+	conn       net.Conn
+	timeout    time.Duration
+	writeMutex sync.Mutex
+	sequence   atomic.Uint32
+	mutex      sync.Mutex
+	pending    map[uint32]chan *smppPdu
+	closed     chan struct{}
+	closeOnce  sync.Once
+}
+
+func dialSmpp(ctx context.Context, c *SmppConfig) (*smppConn, error) {
+	dialer := &net.Dialer{Timeout: c.Timeout}
+
+	var conn net.Conn
+	var err error
+
+	if c.UseTls {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: c.TlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", c.Address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.Address)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to SMSC: %v", err)
+	}
+
+	res := &smppConn{
+		conn:    conn,
+		timeout: c.Timeout,
+		pending: map[uint32]chan *smppPdu{},
+		closed:  make(chan struct{}),
+	}
+
+	go res.readLoop()
+
+	err = res.bind(ctx, c)
+	if err != nil {
+		res.close()
+		return nil, err
+	}
+
+	if c.EnquireLinkInterval > 0 {
+		go res.enquireLinkLoop(c.EnquireLinkInterval)
+	}
+
+	return res, nil
+}
+
+func (s *smppConn) bind(ctx context.Context, c *SmppConfig) error {
+	body := new(smppBodyWriter).
+		cString(c.SystemId).
+		cString(c.Password).
+		cString(c.SystemType).
+		octet(smppInterfaceVersion).
+		octet(0).
+		octet(0).
+		cString("").
+		bytes()
+
+	resp, err := s.request(ctx, smppBindTransceiver, body)
+	if err != nil {
+		return fmt.Errorf("unable to bind to SMSC: %v", err)
+	}
+
+	if resp.status != smppStatusOk {
+		return fmt.Errorf("SMSC rejected bind with status 0x%08X", resp.status)
+	}
+
+	return nil
+}
+
+func (s *smppConn) nextSequence() uint32 {
+	// Sequence numbers are restricted to the range 0x00000001 to 0x7FFFFFFF
+	return (s.sequence.Add(1)-1)%0x7FFFFFFF + 1
+}
+
+func (s *smppConn) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *smppConn) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.conn.Close()
+	})
+}
+
+func (s *smppConn) write(p *smppPdu) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+
+	_, err := s.conn.Write(p.marshal())
+	if err != nil {
+		s.close()
+		return err
+	}
+
+	return nil
+}
+
+// request sends a PDU to the SMSC and waits for the corresponding response
+func (s *smppConn) request(ctx context.Context, commandId uint32, body []byte) (*smppPdu, error) {
+	p := &smppPdu{
+		commandId: commandId,
+		sequence:  s.nextSequence(),
+		body:      body,
+	}
+
+	respChan := make(chan *smppPdu, 1)
+
+	s.mutex.Lock()
+	s.pending[p.sequence] = respChan
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.pending, p.sequence)
+		s.mutex.Unlock()
+	}()
+
+	if s.isClosed() {
+		return nil, errSmppNotSent
+	}
+
+	err := s.write(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errSmppNotSent, err)
+	}
+
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-respChan:
+		if resp.commandId == smppGenericNack {
+			return nil, fmt.Errorf("SMSC responded with generic_nack status 0x%08X", resp.status)
+		}
+
+		if resp.commandId != commandId|smppResponseBit {
+			return nil, fmt.Errorf("unexpected SMPP response 0x%08X", resp.commandId)
+		}
+
+		return resp, nil
+	case <-s.closed:
+		return nil, ErrSmppConnectionClosed
+	case <-timer.C:
+		// The state of the session is unknown. Therefore a new session is used for the next request.
+		s.close()
+		return nil, fmt.Errorf("timeout while waiting for SMPP response")
+	case <-ctx.Done():
+		s.close()
+		return nil, fmt.Errorf("waiting for SMPP response aborted: %w", ctx.Err())
+	}
+}
+
+func (s *smppConn) respond(req *smppPdu, commandId uint32, status uint32, body []byte) {
+	resp := &smppPdu{
+		commandId: commandId,
+		status:    status,
+		sequence:  req.sequence,
+		body:      body,
+	}
+
+	_ = s.write(resp)
+}
+
+func (s *smppConn) readLoop() {
+	defer s.close()
+
+	for {
+		p, err := readSmppPdu(s.conn)
+		if err != nil {
+			return
+		}
+
+		if p.commandId&smppResponseBit != 0 {
+			s.mutex.Lock()
+			respChan, ok := s.pending[p.sequence]
+			s.mutex.Unlock()
+
+			if ok {
+				respChan <- p
+			}
+
+			continue
+		}
+
+		switch p.commandId {
+		case smppEnquireLink:
+			s.respond(p, smppEnquireLinkResp, smppStatusOk, nil)
+		case smppDeliverSm:
+			// Delivery receipts and mobile originated messages are not used. They are acknowledged
+			// nonetheless as otherwise the SMSC would send them again.
+			s.respond(p, smppDeliverSmResp, smppStatusOk, []byte{0})
+		case smppUnbind:
+			s.respond(p, smppUnbindResp, smppStatusOk, nil)
+			return
+		default:
+			s.respond(p, smppGenericNack, smppStatusInvalidCommand, nil)
+		}
+	}
+}
+
+func (s *smppConn) enquireLinkLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-ticker.C:
+			_, err := s.request(context.Background(), smppEnquireLink, nil)
+			if err != nil {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+func (s *smppConn) unbind() {
+	_, _ = s.request(context.Background(), smppUnbind, nil)
+	s.close()
+}
@@ -0,0 +1,441 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type smppSubmitted struct {
+	destination  string
+	esmClass     byte
+	dataCoding   byte
+	shortMessage []byte
+}
+
+// smppSimulator is a minimal SMSC which accepts binds with a fixed password and records all
+// submitted messages
+type smppSimulator struct {
+	listener     net.Listener
+	mutex        sync.Mutex
+	submitted    []smppSubmitted
+	binds        int
+	enquireLinks int
+	conns        []net.Conn
+	// Numbers of the submit_sm requests which are rejected, starting with 1
+	rejected    map[int]bool
+	submitCount int
+}
+
+func newSmppSimulator(t *testing.T) *smppSimulator {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+
+	res := &smppSimulator{listener: l}
+	go res.accept()
+
+	return res
+}
+
+func (s *smppSimulator) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+
+		go s.serve(conn)
+	}
+}
+
+// dropConnections simulates a network failure
+func (s *smppSimulator) dropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, j := range s.conns {
+		j.Close()
+	}
+
+	s.conns = nil
+}
+
+func (s *smppSimulator) close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+func (s *smppSimulator) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		p, err := readSmppPdu(conn)
+		if err != nil {
+			return
+		}
+
+		resp := &smppPdu{commandId: p.commandId | smppResponseBit, sequence: p.sequence}
+		r := &smppBodyReader{data: p.body}
+
+		switch p.commandId {
+		case smppBindTransceiver:
+			r.cString()
+			password, _ := r.cString()
+			if password != "secret" {
+				resp.status = 0x0E
+			}
+
+			s.mutex.Lock()
+			s.binds++
+			s.mutex.Unlock()
+
+			resp.body = []byte("SMSC\x00")
+		case smppSubmitSm:
+			msg, err := parseSubmitSm(r)
+			if err != nil {
+				resp.status = 0x01
+				break
+			}
+
+			s.mutex.Lock()
+			s.submitCount++
+			if s.rejected[s.submitCount] {
+				resp.status = 0x45
+			} else {
+				s.submitted = append(s.submitted, msg)
+			}
+			s.mutex.Unlock()
+
+			resp.body = []byte("id\x00")
+		case smppEnquireLink:
+			s.mutex.Lock()
+			s.enquireLinks++
+			s.mutex.Unlock()
+		case smppUnbind:
+		default:
+			resp.commandId = smppGenericNack
+			resp.status = smppStatusInvalidCommand
+		}
+
+		conn.Write(resp.marshal())
+	}
+}
+
+func parseSubmitSm(r *smppBodyReader) (smppSubmitted, error) {
+	res := smppSubmitted{}
+
+	r.cString()
+	r.octets(2)
+	r.cString()
+	r.octets(2)
+
+	dest, err := r.cString()
+	if err != nil {
+		return res, err
+	}
+
+	res.destination = dest
+	res.esmClass, _ = r.octet()
+	r.octets(2)
+	r.cString()
+	r.cString()
+	r.octets(2)
+	res.dataCoding, _ = r.octet()
+	r.octet()
+
+	l, err := r.octet()
+	if err != nil {
+		return res, err
+	}
+
+	res.shortMessage, err = r.octets(int(l))
+
+	return res, err
+}
+
+func (s *smppSimulator) getSubmitted() []smppSubmitted {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]smppSubmitted{}, s.submitted...)
+}
+
+func newTestSmppSender(sim *smppSimulator) *SmppSender {
+	return NewSmppSender(SmppConfig{
+		Address:    sim.listener.Addr().String(),
+		SystemId:   "notifier",
+		Password:   "secret",
+		SourceAddr: "Notifier",
+		Timeout:    2 * time.Second,
+	})
+}
+
+func TestGsm7Table(t *testing.T) {
+	if len([]rune(gsm7BasicChars)) != 128 {
+		t.Fatalf("GSM-7 table has wrong length: %d", len([]rune(gsm7BasicChars)))
+	}
+
+	septets, ok := EncodeGSM7("A€ü")
+	if !ok || (string(septets) != "\x41\x1b\x65\x7e") {
+		t.Errorf("Wrong encoding: %v", septets)
+	}
+
+	if IsGSM7("Привет") {
+		t.Errorf("Cyrillic text is not GSM-7")
+	}
+}
+
+func TestSmppSenderSingle(t *testing.T) {
+	sim := newSmppSimulator(t)
+	defer sim.close()
+
+	sender := newTestSmppSender(sim)
+	defer sender.Close()
+
+	err := sender.Send(context.Background(), "+491701234567", "Hallo Welt", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	msgs := sim.getSubmitted()
+	if len(msgs) != 1 {
+		t.Fatalf("Wrong number of messages: %d", len(msgs))
+	}
+
+	if (msgs[0].destination != "491701234567") || (msgs[0].dataCoding != smppCodingGSM7) || (msgs[0].esmClass != 0) {
+		t.Errorf("Wrong message: %v", msgs[0])
+	}
+
+	if string(msgs[0].shortMessage) != "Hallo Welt" {
+		t.Errorf("Wrong text: %v", msgs[0].shortMessage)
+	}
+}
+
+func TestSmppSenderConcatenated(t *testing.T) {
+	sim := newSmppSimulator(t)
+	defer sim.close()
+
+	sender := newTestSmppSender(sim)
+	defer sender.Close()
+
+	message := ""
+	for i := 0; i < 40; i++ {
+		message += "abcdefg€"
+	}
+
+	err := sender.Send(context.Background(), "491701234567", message, &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	msgs := sim.getSubmitted()
+	if len(msgs) != 3 {
+		t.Fatalf("Wrong number of parts: %d", len(msgs))
+	}
+
+	text := []byte{}
+	for i, j := range msgs {
+		if (j.esmClass != smppEsmUdhi) || (j.dataCoding != smppCodingGSM7) {
+			t.Errorf("Wrong flags in part %d", i+1)
+		}
+
+		udh := j.shortMessage[:6]
+		if (udh[0] != 5) || (udh[4] != 3) || (int(udh[5]) != i+1) || (udh[3] != msgs[0].shortMessage[3]) {
+			t.Errorf("Wrong UDH in part %d: %v", i+1, udh)
+		}
+
+		if len(j.shortMessage)-6 > smppMaxGSM7Part {
+			t.Errorf("Part %d too long", i+1)
+		}
+
+		if j.shortMessage[len(j.shortMessage)-1] == gsm7Escape {
+			t.Errorf("Escape sequence split in part %d", i+1)
+		}
+
+		text = append(text, j.shortMessage[6:]...)
+	}
+
+	septets, _ := EncodeGSM7(message)
+	if string(text) != string(septets) {
+		t.Errorf("Reassembled message differs")
+	}
+}
+
+func TestSmppSenderUcs2(t *testing.T) {
+	sim := newSmppSimulator(t)
+	defer sim.close()
+
+	sender := newTestSmppSender(sim)
+	defer sender.Close()
+
+	err := sender.Send(context.Background(), "491701234567", "Привет", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	msgs := sim.getSubmitted()
+	if (len(msgs) != 1) || (msgs[0].dataCoding != smppCodingUCS2) || (len(msgs[0].shortMessage) != 12) {
+		t.Fatalf("Wrong message: %v", msgs)
+	}
+
+	if (msgs[0].shortMessage[0] != 0x04) || (msgs[0].shortMessage[1] != 0x1F) {
+		t.Errorf("Wrong encoding: %v", msgs[0].shortMessage)
+	}
+
+	// Each emoji needs a surrogate pair. Therefore a part of at most 67 code units can only
+	// hold 33 of them.
+	message := ""
+	for i := 0; i < 36; i++ {
+		message += "😀"
+	}
+
+	parts, _, coding, err := splitSmppMessage(message, 1)
+	if (err != nil) || (coding != smppCodingUCS2) || (len(parts) != 2) {
+		t.Fatalf("Wrong split: %d parts", len(parts))
+	}
+
+	if len(parts[0])-6 != 132 {
+		t.Errorf("Surrogate pair split: %d", len(parts[0])-6)
+	}
+}
+
+func TestSmppSenderPartialDelivery(t *testing.T) {
+	sim := newSmppSimulator(t)
+	defer sim.close()
+
+	sender := newTestSmppSender(sim)
+	defer sender.Close()
+
+	message := strings.Repeat("abcdefgh", 40)
+	sim.rejected = map[int]bool{2: true}
+
+	err := sender.Send(context.Background(), "491701234567", message, &MessageInfo{})
+
+	var partial *PartialDeliveryError
+	if !errors.As(err, &partial) || (partial.Remaining != message[smppMaxGSM7Part:]) {
+		t.Fatalf("Partial delivery not reported: %v", err)
+	}
+
+	// Only the rest of the message is sent again
+	sim.mutex.Lock()
+	sim.submitted = nil
+	sim.submitCount = 0
+	sim.mutex.Unlock()
+
+	channels := []Channel{{AddrType: TypeSmpp, Address: "491701234567", Sender: sender}}
+	_, err = SendWithFallback(context.Background(), channels, message, &MessageInfo{}, DirectSend)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	msgs := sim.getSubmitted()
+	if len(msgs) != 3 {
+		t.Fatalf("Wrong number of parts: %d", len(msgs))
+	}
+
+	if msgs[1].shortMessage[3] == msgs[0].shortMessage[3] {
+		t.Errorf("Rest of the message uses the same reference number")
+	}
+
+	rest := []byte{}
+	for _, j := range msgs[1:] {
+		rest = append(rest, j.shortMessage[6:]...)
+	}
+
+	septets, _ := EncodeGSM7(ContinuationPrefix + message[smppMaxGSM7Part:])
+	if string(rest) != string(septets) {
+		t.Errorf("Wrong rest of message: %s", string(rest))
+	}
+}
+
+func TestSmppSenderReconnect(t *testing.T) {
+	sim := newSmppSimulator(t)
+	defer sim.close()
+
+	sender := newTestSmppSender(sim)
+	defer sender.Close()
+
+	err := sender.Send(context.Background(), "491701234567", "first", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	sim.dropConnections()
+
+	// Give the read loop the chance to notice the lost connection
+	time.Sleep(100 * time.Millisecond)
+
+	err = sender.Send(context.Background(), "491701234567", "second", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending after reconnect failed: %v", err)
+	}
+
+	if len(sim.getSubmitted()) != 2 {
+		t.Errorf("Wrong number of messages")
+	}
+
+	sim.mutex.Lock()
+	binds := sim.binds
+	sim.mutex.Unlock()
+
+	if binds != 2 {
+		t.Errorf("Wrong number of binds: %d", binds)
+	}
+}
+
+func TestSmppSenderEnquireLinkAndBind(t *testing.T) {
+	sim := newSmppSimulator(t)
+	defer sim.close()
+
+	sender := newTestSmppSender(sim)
+	sender.Config.EnquireLinkInterval = 20 * time.Millisecond
+	defer sender.Close()
+
+	err := sender.Send(context.Background(), "491701234567", "test", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	sim.mutex.Lock()
+	enquireLinks := sim.enquireLinks
+	sim.mutex.Unlock()
+
+	if enquireLinks == 0 {
+		t.Errorf("No enquire_link sent")
+	}
+
+	wrong := newTestSmppSender(sim)
+	wrong.Config.Password = "wrong"
+
+	err = wrong.Send(context.Background(), "491701234567", "test", &MessageInfo{})
+	if err == nil {
+		t.Errorf("Rejected bind was not detected")
+	}
+}
+
+func TestSmppSegments(t *testing.T) {
+	s := NewSmppSender(SmppConfig{})
+
+	if s.Segments("Hello") != 1 {
+		t.Errorf("Short message needs more than one segment")
+	}
+
+	// 150 UCS-2 characters need three parts of at most 67 characters
+	message := strings.Repeat("Привет", 25)
+
+	if (s.Segments(message) != 3) || (CountSegments(s, message) != 3) {
+		t.Errorf("Wrong number of segments: %d", s.Segments(message))
+	}
+}
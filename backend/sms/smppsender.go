@@ -0,0 +1,403 @@
+package sms
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"notifier/tools"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
+)
+
+const envSmppAddress = "MN_SMPP_ADDRESS"
+const envSmppSystemId = "MN_SMPP_SYSTEM_ID"
+const envSmppPassword = "MN_SMPP_PASSWORD"
+const envSmppSystemType = "MN_SMPP_SYSTEM_TYPE"
+const envSmppSourceAddr = "MN_SMPP_SOURCE_ADDR"
+const envSmppTls = "MN_SMPP_TLS"
+const envSmppEnquireLink = "MN_SMPP_ENQUIRE_LINK"
+
+const defaultSmppEnquireLink = 30 * time.Second
+const defaultSmppTimeout = 10 * time.Second
+
+// Data coding schemes
+const smppCodingGSM7 = 0x00
+const smppCodingUCS2 = 0x08
+
+// Maximum number of characters in a single message and in one part of a concatenated message. For
+// GSM-7 these are septets and for UCS-2 UTF-16 code units.
+const smppMaxGSM7 = 160
+const smppMaxGSM7Part = 153
+const smppMaxUCS2 = 70
+const smppMaxUCS2Part = 67
+
+// The user data header of a part of a concatenated message contains its number and the total number of parts.
+// Therefore no more than 255 parts are possible.
+const smppMaxParts = 255
+
+// esm_class flag which signals that the short message starts with a user data header
+const smppEsmUdhi = 0x40
+
+// Type of number and numbering plan indicator
+const smppTonInternational = 0x01
+const smppTonAlphanumeric = 0x05
+const smppNpiUnknown = 0x00
+const smppNpiIsdn = 0x01
+
+// SmppConfig contains the parameters needed to bind to an SMSC
+type SmppConfig struct {
+	Address    string
+	SystemId   string
+	Password   string
+	SystemType string
+	// SourceAddr is either a phone number or an alphanumeric sender id
+	SourceAddr string
+	UseTls     bool
+	TlsConfig  *tls.Config
+	// EnquireLinkInterval determines how often the connection is checked. Zero turns this check off.
+	EnquireLinkInterval time.Duration
+	// Timeout is used for connecting and for waiting on responses of the SMSC
+	Timeout time.Duration
+}
+
+// SmppSender sends SMS directly to an SMSC via SMPP 3.4. The address of a recipient is a phone
+// number including the international access code. A leading + is optional. The connection to
+// the SMSC is established when the first message is sent and reestablished when it is lost.
+type SmppSender struct {
+	Config    SmppConfig
+	mutex     sync.Mutex
+	conn      *smppConn
+	reference atomic.Uint32
+}
+
+func NewSmppSender(config SmppConfig) *SmppSender {
+	return &SmppSender{
+		Config: config,
+	}
+}
+
+func NewSmppSenderFromEnvironment() (*SmppSender, error) {
+	config := SmppConfig{
+		EnquireLinkInterval: defaultSmppEnquireLink,
+		Timeout:             defaultSmppTimeout,
+	}
+
+	mandatory := []struct {
+		env   string
+		value *string
+	}{
+		{envSmppAddress, &config.Address},
+		{envSmppSystemId, &config.SystemId},
+		{envSmppPassword, &config.Password},
+		{envSmppSourceAddr, &config.SourceAddr},
+	}
+
+	for _, j := range mandatory {
+		val, ok := os.LookupEnv(j.env)
+		if !ok {
+			return nil, fmt.Errorf("Environment variable %s not set", j.env)
+		}
+
+		*j.value = val
+	}
+
+	config.SystemType, _ = os.LookupEnv(envSmppSystemType)
+
+	useTls, ok := os.LookupEnv(envSmppTls)
+	if ok {
+		val, err := strconv.ParseBool(useTls)
+		if err != nil {
+			return nil, fmt.Errorf("Value of %s is not a boolean", envSmppTls)
+		}
+
+		config.UseTls = val
+	}
+
+	if config.UseTls {
+		tlsConfig, err := tools.MakeCustomTlsConfig()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create custom TLS config: %v", err)
+		}
+
+		config.TlsConfig = tlsConfig
+	}
+
+	enquireLink, ok := os.LookupEnv(envSmppEnquireLink)
+	if ok {
+		val, err := strconv.ParseUint(enquireLink, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Value of %s is not a number of seconds", envSmppEnquireLink)
+		}
+
+		config.EnquireLinkInterval = time.Duration(val) * time.Second
+	}
+
+	return NewSmppSender(config), nil
+}
+
+func (s *SmppSender) GetName() string {
+	return TypeSmpp
+}
+
+// Close unbinds from the SMSC. A subsequent call of Send establishes a new connection.
+func (s *SmppSender) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn != nil {
+		s.conn.unbind()
+		s.conn = nil
+	}
+}
+
+// Probe binds to the SMSC if there is no connection yet
+func (s *SmppSender) Probe(ctx context.Context) error {
+	_, err := s.getConnection(ctx)
+	return err
+}
+
+func (s *SmppSender) getConnection(ctx context.Context) (*smppConn, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if (s.conn != nil) && !s.conn.isClosed() {
+		return s.conn, nil
+	}
+
+	conn, err := dialSmpp(ctx, &s.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	s.conn = conn
+
+	return conn, nil
+}
+
+// Send returns a PartialDeliveryError if some parts of a concatenated message were submitted. Its
+// Remaining field contains the text of the parts which were not submitted.
+func (s *SmppSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	parts, texts, dataCoding, err := splitSmppMessage(message, byte(s.reference.Add(1)))
+	if err != nil {
+		return err
+	}
+
+	esmClass := byte(0)
+	if len(parts) > 1 {
+		esmClass = smppEsmUdhi
+	}
+
+	for i, j := range parts {
+		err = s.submit(ctx, recipientAddress, j, esmClass, dataCoding)
+		if err == nil {
+			continue
+		}
+
+		if i > 0 {
+			// The handset is unable to reassemble the message if the submitted parts are sent again
+			return &PartialDeliveryError{Remaining: strings.Join(texts[i:], ""), Err: err}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *SmppSender) submit(ctx context.Context, recipientAddress string, shortMessage []byte, esmClass byte, dataCoding byte) error {
+	sourceTon, sourceNpi, sourceAddr := smppSourceAddress(s.Config.SourceAddr)
+
+	body := new(smppBodyWriter).
+		cString("").
+		octet(sourceTon).
+		octet(sourceNpi).
+		cString(sourceAddr).
+		octet(smppTonInternational).
+		octet(smppNpiIsdn).
+		cString(strings.TrimPrefix(recipientAddress, "+")).
+		octet(esmClass).
+		octet(0).
+		octet(0).
+		cString("").
+		cString("").
+		octet(0).
+		octet(0).
+		octet(dataCoding).
+		octet(0).
+		octet(byte(len(shortMessage))).
+		octets(shortMessage).
+		bytes()
+
+	conn, err := s.getConnection(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := conn.request(ctx, smppSubmitSm, body)
+	if errors.Is(err, errSmppNotSent) {
+		// The connection was lost since the last message has been sent. As the SMSC has not
+		// received anything it is safe to try again on a new connection.
+		conn, err = s.getConnection(ctx)
+		if err != nil {
+			return err
+		}
+
+		resp, err = conn.request(ctx, smppSubmitSm, body)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to submit SMS: %v", err)
+	}
+
+	if resp.status != smppStatusOk {
+		return fmt.Errorf("SMSC rejected SMS with status 0x%08X", resp.status)
+	}
+
+	return nil
+}
+
+func smppSourceAddress(addr string) (byte, byte, string) {
+	number := strings.TrimPrefix(addr, "+")
+
+	for _, j := range number {
+		if (j < '0') || (j > '9') {
+			return smppTonAlphanumeric, smppNpiUnknown, addr
+		}
+	}
+
+	return smppTonInternational, smppNpiIsdn, number
+}
+
+// Segments returns the number of SMS which are needed to send the message as a concatenated SMS
+func (s *SmppSender) Segments(message string) int {
+	parts, _, _, err := splitSmppMessage(message, 0)
+	if err != nil {
+		return smppMaxParts
+	}
+
+	return len(parts)
+}
+
+// splitSmppMessage encodes the message in GSM-7 if possible and in UCS-2 otherwise. If the message
+// does not fit into a single SMS it is split into parts which are prefixed with a user data header
+// that allows the handset to reassemble the message. The reference number identifies the parts
+// which belong together. The second return value contains the text of each part.
+func splitSmppMessage(message string, reference byte) ([][]byte, []string, byte, error) {
+	var units [][]byte
+	var dataCoding byte
+	var maxSingle, maxPart int
+
+	septets, ok := EncodeGSM7(message)
+	if ok {
+		dataCoding, maxSingle, maxPart = smppCodingGSM7, smppMaxGSM7, smppMaxGSM7Part
+		units = gsm7Units(septets)
+	} else {
+		dataCoding, maxSingle, maxPart = smppCodingUCS2, smppMaxUCS2, smppMaxUCS2Part
+		units = ucs2Units(message)
+	}
+
+	total := 0
+	for _, j := range units {
+		total += len(j) / unitSize(dataCoding)
+	}
+
+	if total <= maxSingle {
+		return [][]byte{joinUnits(units)}, []string{message}, dataCoding, nil
+	}
+
+	// Each unit encodes exactly one character
+	characters := []rune(message)
+	chunks := [][]byte{}
+	texts := []string{}
+	current := []byte{}
+	currentLen := 0
+	currentStart := 0
+
+	for i, j := range units {
+		l := len(j) / unitSize(dataCoding)
+		if currentLen+l > maxPart {
+			chunks = append(chunks, current)
+			texts = append(texts, string(characters[currentStart:i]))
+			current = []byte{}
+			currentLen = 0
+			currentStart = i
+		}
+
+		current = append(current, j...)
+		currentLen += l
+	}
+
+	chunks = append(chunks, current)
+	texts = append(texts, string(characters[currentStart:]))
+
+	if len(chunks) > smppMaxParts {
+		return nil, nil, 0, fmt.Errorf("message is too long")
+	}
+
+	res := [][]byte{}
+
+	for i, j := range chunks {
+		udh := []byte{0x05, 0x00, 0x03, reference, byte(len(chunks)), byte(i + 1)}
+		res = append(res, append(udh, j...))
+	}
+
+	return res, texts, dataCoding, nil
+}
+
+func unitSize(dataCoding byte) int {
+	if dataCoding == smppCodingUCS2 {
+		return 2
+	}
+
+	return 1
+}
+
+// gsm7Units groups the septets in such a way that an escape sequence is never split across two parts
+func gsm7Units(septets []byte) [][]byte {
+	res := [][]byte{}
+
+	for i := 0; i < len(septets); i++ {
+		if (septets[i] == gsm7Escape) && (i+1 < len(septets)) {
+			res = append(res, septets[i:i+2])
+			i++
+			continue
+		}
+
+		res = append(res, septets[i:i+1])
+	}
+
+	return res
+}
+
+// ucs2Units returns the big endian UTF-16 encoding of each character. Characters outside the basic
+// multilingual plane are represented by a surrogate pair which is never split across two parts.
+func ucs2Units(message string) [][]byte {
+	res := [][]byte{}
+
+	for _, j := range message {
+		unit := []byte{}
+		for _, k := range utf16.Encode([]rune{j}) {
+			unit = append(unit, byte(k>>8), byte(k))
+		}
+
+		res = append(res, unit)
+	}
+
+	return res
+}
+
+func joinUnits(units [][]byte) []byte {
+	res := []byte{}
+
+	for _, j := range units {
+		res = append(res, j...)
+	}
+
+	return res
+}
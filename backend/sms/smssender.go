@@ -2,19 +2,35 @@ package sms
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
-const lenMessageMax = 160
-
+// SmsSender sends a message to an address. info describes the context in which the message is sent
+// including the options of the recipient and the reminder. It is never nil. Implementations have to
+// abort sending and return an error as soon as ctx is done.
 type SmsSender interface {
-	Send(recipientAddress string, message string) error
+	Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error
 	GetName() string
 }
 
+// sleepContext waits for the given duration. It returns early with an error if ctx is done before.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func NewIftttSender(apiKey string) *iftttSmsSender {
 	res := new(iftttSmsSender)
 	res.apiKey = apiKey
@@ -30,18 +46,18 @@ type iftttSmsSender struct {
 	apiKey string
 }
 
+// MaxMessageLength returns the length of a single SMS. Longer messages are split into several SMS.
+func (i *iftttSmsSender) MaxMessageLength() MessageLimit {
+	return SmsLimit
+}
+
 func (i *iftttSmsSender) GetName() string {
 	return "IFTTT"
 }
 
-func (i *iftttSmsSender) Send(recipientAddress string, message string) error {
+func (i *iftttSmsSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
 	requestURL := fmt.Sprintf("https://maker.ifttt.com/trigger/%s/with/key/%s", recipientAddress, i.apiKey)
 
-	if len([]rune(message)) > lenMessageMax {
-		temp := message
-		message = string([]rune(temp)[:lenMessageMax])
-	}
-
 	var ifftData ifftBody
 	ifftData.Value1 = message
 
@@ -50,7 +66,7 @@ func (i *iftttSmsSender) Send(recipientAddress string, message string) error {
 		return err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, requestURL, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
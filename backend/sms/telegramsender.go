@@ -0,0 +1,167 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"notifier/tools"
+	"os"
+	"strings"
+	"time"
+)
+
+const envTelegramToken = "MN_TELEGRAM_TOKEN"
+const envTelegramApiUrl = "MN_TELEGRAM_API_URL"
+const defaultTelegramApiUrl = "https://api.telegram.org"
+
+// Telegram asks clients which send too many messages to wait. The sender waits at most
+// telegramMaxRetryAfter and retries at most telegramMaxRetries times. After that the
+// error is passed on to the caller which can schedule a retry later.
+const telegramMaxRetries = 3
+const telegramMaxRetryAfter = 30 * time.Second
+
+const telegramSpecialChars = "_*[]()~`>#+-=|{}.!\\"
+
+// Telegram rejects messages which are longer than 4096 characters after the markup has been parsed
+const telegramMaxLength = 4096
+
+type telegramRequest struct {
+	ChatId    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode"`
+}
+
+type telegramResponse struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// TelegramSender uses the Telegram Bot API to send messages. The address of a recipient is a chat id.
+type TelegramSender struct {
+	ApiUrl string
+	Token  string
+	Client *http.Client
+	sleep  func(context.Context, time.Duration) error
+}
+
+func NewTelegramSender(apiUrl string, token string, c *http.Client) *TelegramSender {
+	return &TelegramSender{
+		ApiUrl: strings.TrimSuffix(apiUrl, "/"),
+		Token:  token,
+		Client: c,
+		sleep:  sleepContext,
+	}
+}
+
+func NewTelegramSenderFromEnvironment() (*TelegramSender, error) {
+	token, ok := os.LookupEnv(envTelegramToken)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envTelegramToken)
+	}
+
+	apiUrl, ok := os.LookupEnv(envTelegramApiUrl)
+	if !ok {
+		apiUrl = defaultTelegramApiUrl
+	}
+
+	client, err := tools.MakeCustomHttpClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom HTTP client object: %v", err)
+	}
+
+	return NewTelegramSender(apiUrl, token, client), nil
+}
+
+// EscapeMarkdownV2 escapes all characters which have a special meaning in Telegram's MarkdownV2
+func EscapeMarkdownV2(text string) string {
+	var res strings.Builder
+
+	for _, j := range text {
+		if strings.ContainsRune(telegramSpecialChars, j) {
+			res.WriteRune('\\')
+		}
+		res.WriteRune(j)
+	}
+
+	return res.String()
+}
+
+func (t *TelegramSender) MaxMessageLength() MessageLimit {
+	return MessageLimit{GSM7: telegramMaxLength, UCS2: telegramMaxLength}
+}
+
+func (t *TelegramSender) GetName() string {
+	return TypeTelegram
+}
+
+// sendOnce returns the time to wait before the next attempt if Telegram rejected the request
+// because of too many requests
+func (t *TelegramSender) sendOnce(ctx context.Context, body []byte) (time.Duration, error) {
+	requestUrl := fmt.Sprintf("%s/bot%s/sendMessage", t.ApiUrl, t.Token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestUrl, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := t.Client.Do(req)
+	if err != nil {
+		// Do not leak the token which is part of the URL
+		return 0, fmt.Errorf("unable to contact Telegram API")
+	}
+	defer res.Body.Close()
+
+	respData, _ := io.ReadAll(res.Body)
+
+	if (res.StatusCode >= 200) && (res.StatusCode < 300) {
+		return 0, nil
+	}
+
+	var resp telegramResponse
+	_ = json.Unmarshal(respData, &resp)
+
+	if res.StatusCode == http.StatusTooManyRequests {
+		retryAfter := max(resp.Parameters.RetryAfter, 1)
+		return time.Duration(retryAfter) * time.Second, fmt.Errorf("rate limit exceeded, retry after %d seconds", retryAfter)
+	}
+
+	return 0, fmt.Errorf("server responded with error code %d: %s", res.StatusCode, resp.Description)
+}
+
+func (t *TelegramSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	tgReq := telegramRequest{
+		ChatId:    recipientAddress,
+		Text:      EscapeMarkdownV2(message),
+		ParseMode: "MarkdownV2",
+	}
+
+	body, err := json.Marshal(&tgReq)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		retryAfter, err := t.sendOnce(ctx, body)
+		if (err == nil) || (retryAfter == 0) {
+			return err
+		}
+
+		if (i >= telegramMaxRetries) || (retryAfter > telegramMaxRetryAfter) {
+			return err
+		}
+
+		err = t.sleep(ctx, retryAfter)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	escaped := EscapeMarkdownV2("Geburtstag (Oma) am 1.2. - *wichtig*!")
+	expected := `Geburtstag \(Oma\) am 1\.2\. \- \*wichtig\*\!`
+
+	if escaped != expected {
+		t.Errorf("Wrong escaping: %s", escaped)
+	}
+}
+
+func TestTelegramSender(t *testing.T) {
+	var got telegramRequest
+	var gotPath string
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		gotPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+
+		if calls == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":5}}`))
+			return
+		}
+
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	waited := time.Duration(0)
+	sender := NewTelegramSender(server.URL, "123:abc", server.Client())
+	sender.sleep = func(ctx context.Context, d time.Duration) error { waited += d; return nil }
+
+	err := sender.Send(context.Background(), "-100123", "Termin um 10.00", &MessageInfo{})
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (calls != 2) || (waited != 5*time.Second) {
+		t.Errorf("Rate limit not handled: %d calls, waited %v", calls, waited)
+	}
+
+	if (gotPath != "/bot123:abc/sendMessage") || (got.ChatId != "-100123") || (got.Text != `Termin um 10\.00`) || (got.ParseMode != "MarkdownV2") {
+		t.Errorf("Wrong request: %s %v", gotPath, got)
+	}
+}
+
+func TestTelegramSenderRetryAfterTooLong(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"ok":false,"error_code":429,"parameters":{"retry_after":3600}}`))
+	}))
+	defer server.Close()
+
+	sender := NewTelegramSender(server.URL, "123:abc", server.Client())
+	sender.sleep = func(ctx context.Context, d time.Duration) error { t.Errorf("Sender should not wait"); return nil }
+
+	err := sender.Send(context.Background(), "42", "test", &MessageInfo{})
+	if err == nil {
+		t.Errorf("Rate limit was not reported")
+	}
+}
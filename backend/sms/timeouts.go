@@ -0,0 +1,72 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"notifier/tools"
+	"strconv"
+	"time"
+)
+
+const DefaultSendTimeout = 30 * time.Second
+
+// SendTimeouts defines how long each sender is allowed to take for sending a message. The timeouts are
+// defined per sender name, i.e. the value returned by SmsSender.GetName().
+type SendTimeouts struct {
+	defaultTimeout time.Duration
+	timeouts       map[string]time.Duration
+}
+
+func NewSendTimeouts(timeouts map[string]time.Duration, defaultTimeout time.Duration) *SendTimeouts {
+	if defaultTimeout <= 0 {
+		defaultTimeout = DefaultSendTimeout
+	}
+
+	if timeouts == nil {
+		timeouts = map[string]time.Duration{}
+	}
+
+	return &SendTimeouts{
+		defaultTimeout: defaultTimeout,
+		timeouts:       timeouts,
+	}
+}
+
+// ParseSendTimeouts parses a specification like "Mail=60,IFTTT=10", where the values are given in
+// seconds, into a map which can be used to create a SendTimeouts object.
+func ParseSendTimeouts(spec string) (map[string]time.Duration, error) {
+	raw, err := tools.ParseKeyValueList(spec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse send timeouts: %v", err)
+	}
+
+	res := map[string]time.Duration{}
+
+	for i, j := range raw {
+		seconds, err := strconv.Atoi(j)
+		if (err != nil) || (seconds < 1) {
+			return nil, fmt.Errorf("illegal timeout '%s' for sender '%s'", j, i)
+		}
+
+		res[i] = time.Duration(seconds) * time.Second
+	}
+
+	return res, nil
+}
+
+func (t *SendTimeouts) GetTimeout(senderName string) time.Duration {
+	timeout, ok := t.timeouts[senderName]
+	if !ok {
+		return t.defaultTimeout
+	}
+
+	return timeout
+}
+
+// Send can be used as a SendFunc. It cancels sending the message if the sender exceeds its timeout.
+func (t *SendTimeouts) Send(ctx context.Context, s SmsSender, recipientAddress string, message string, info *MessageInfo) error {
+	ctx, cancel := context.WithTimeout(ctx, t.GetTimeout(s.GetName()))
+	defer cancel()
+
+	return s.Send(ctx, recipientAddress, message, info)
+}
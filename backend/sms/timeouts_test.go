@@ -0,0 +1,60 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type hangingSender struct{}
+
+func (h *hangingSender) GetName() string {
+	return "hanging"
+}
+
+func (h *hangingSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSendTimeouts(t *testing.T) {
+	parsed, err := ParseSendTimeouts("Mail=60, hanging=1")
+	if err != nil {
+		t.Fatalf("Parsing failed: %v", err)
+	}
+
+	if (parsed["Mail"] != time.Minute) || (parsed["hanging"] != time.Second) {
+		t.Errorf("Wrong timeouts: %v", parsed)
+	}
+
+	_, err = ParseSendTimeouts("Mail=0")
+	if err == nil {
+		t.Errorf("A timeout of zero should not be accepted")
+	}
+
+	timeouts := NewSendTimeouts(map[string]time.Duration{"hanging": 20 * time.Millisecond}, time.Hour)
+	if timeouts.GetTimeout("Mail") != time.Hour {
+		t.Errorf("Default timeout not used")
+	}
+
+	start := time.Now()
+	_, err = SendWithFallback(context.Background(), []Channel{{AddrType: "test", Address: "a", Sender: &hangingSender{}}}, "test", &MessageInfo{}, timeouts.Send)
+	if !errors.Is(err, context.DeadlineExceeded) || (time.Since(start) > time.Second) {
+		t.Errorf("Timeout not enforced: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	working := &failingSender{}
+	channels := []Channel{
+		{AddrType: "test", Address: "a", Sender: &hangingSender{}},
+		{AddrType: "Mail", Address: "b", Sender: working},
+	}
+
+	_, err = SendWithFallback(ctx, channels, "test", &MessageInfo{}, timeouts.Send)
+	if !errors.Is(err, context.Canceled) || (len(working.received) != 0) {
+		t.Errorf("Cancellation not honoured: %v", err)
+	}
+}
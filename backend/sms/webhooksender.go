@@ -0,0 +1,197 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"notifier/tools"
+	"os"
+	"strings"
+	"text/template"
+)
+
+const envWebhookConfig = "MN_WEBHOOK_CONFIG"
+const defaultHmacHeader = "X-Signature-256"
+
+// WebhookConfig specifies a generic webhook sender. The name of the webhook is used as its address type.
+// The URL and the body are Go templates which are filled with the address, the message and the
+// information from MessageInfo.
+type WebhookConfig struct {
+	Name       string            `json:"name"`
+	Url        string            `json:"url"`
+	Method     string            `json:"method"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	HmacSecret string            `json:"hmac_secret"`
+	HmacHeader string            `json:"hmac_header"`
+	SuccessMin int               `json:"success_min"`
+	SuccessMax int               `json:"success_max"`
+}
+
+// WebhookData is the data which is used to execute the templates of a webhook
+type WebhookData struct {
+	MessageInfo
+	Address string
+	Message string
+}
+
+type WebhookSender struct {
+	config       WebhookConfig
+	urlTemplate  *template.Template
+	bodyTemplate *template.Template
+	client       *http.Client
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"pathescape": url.PathEscape,
+}
+
+func NewWebhookSender(c WebhookConfig, client *http.Client) (*WebhookSender, error) {
+	if (c.Name == "") || (c.Url == "") {
+		return nil, fmt.Errorf("name and url of webhook have to be specified")
+	}
+
+	if c.Method == "" {
+		c.Method = http.MethodPost
+	}
+
+	if c.HmacHeader == "" {
+		c.HmacHeader = defaultHmacHeader
+	}
+
+	if (c.SuccessMin == 0) && (c.SuccessMax == 0) {
+		c.SuccessMin = 200
+		c.SuccessMax = 299
+	}
+
+	if c.SuccessMin > c.SuccessMax {
+		return nil, fmt.Errorf("success status range of webhook '%s' is empty", c.Name)
+	}
+
+	urlTemplate, err := template.New("url").Funcs(webhookFuncs).Parse(c.Url)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse url template of webhook '%s': %v", c.Name, err)
+	}
+
+	bodyTemplate, err := template.New("body").Funcs(webhookFuncs).Parse(c.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse body template of webhook '%s': %v", c.Name, err)
+	}
+
+	res := &WebhookSender{
+		config:       c,
+		urlTemplate:  urlTemplate,
+		bodyTemplate: bodyTemplate,
+		client:       client,
+	}
+
+	return res, nil
+}
+
+// NewWebhookSendersFromEnvironment creates one sender for each webhook which is specified in the JSON
+// file referenced by MN_WEBHOOK_CONFIG
+func NewWebhookSendersFromEnvironment() ([]*WebhookSender, error) {
+	fileName, ok := os.LookupEnv(envWebhookConfig)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envWebhookConfig)
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read webhook config: %v", err)
+	}
+
+	configs := []WebhookConfig{}
+	err = json.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse webhook config: %v", err)
+	}
+
+	client, err := tools.MakeCustomHttpClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom HTTP client object: %v", err)
+	}
+
+	res := []*WebhookSender{}
+
+	for _, j := range configs {
+		sender, err := NewWebhookSender(j, client)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, sender)
+	}
+
+	return res, nil
+}
+
+func (w *WebhookSender) GetName() string {
+	return w.config.Name
+}
+
+func (w *WebhookSender) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.config.HmacSecret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *WebhookSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	data := WebhookData{
+		MessageInfo: *info,
+		Address:     recipientAddress,
+		Message:     message,
+	}
+
+	requestUrl := new(strings.Builder)
+	err := w.urlTemplate.Execute(requestUrl, &data)
+	if err != nil {
+		return fmt.Errorf("unable to create url: %v", err)
+	}
+
+	body := new(bytes.Buffer)
+	err = w.bodyTemplate.Execute(body, &data)
+	if err != nil {
+		return fmt.Errorf("unable to create body: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.config.Method, requestUrl.String(), bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	for i, j := range w.config.Headers {
+		req.Header.Set(i, j)
+	}
+
+	if w.config.HmacSecret != "" {
+		req.Header.Set(w.config.HmacHeader, w.sign(body.Bytes()))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Ignore body
+	io.ReadAll(res.Body)
+
+	if (res.StatusCode < w.config.SuccessMin) || (res.StatusCode > w.config.SuccessMax) {
+		return fmt.Errorf("server responded with error code %d", res.StatusCode)
+	}
+
+	return nil
+}
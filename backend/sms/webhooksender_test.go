@@ -0,0 +1,81 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"notifier/tools"
+	"testing"
+)
+
+func TestWebhookSender(t *testing.T) {
+	var gotPath, gotBody, gotHeader, gotSignature, gotMethod string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod = r.Method
+		gotPath = r.URL.Path
+		gotBody = string(body)
+		gotHeader = r.Header.Get("Content-Type")
+		gotSignature = r.Header.Get("X-Sig")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	config := WebhookConfig{
+		Name:       "chat",
+		Url:        server.URL + "/hook/{{pathescape .Address}}",
+		Method:     http.MethodPut,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       `{"text":{{json .Message}},"reminder":{{json .ReminderDescription}}}`,
+		HmacSecret: "secret",
+		HmacHeader: "X-Sig",
+	}
+
+	sender, err := NewWebhookSender(config, server.Client())
+	if err != nil {
+		t.Fatalf("Unable to create sender: %v", err)
+	}
+
+	info := MessageInfo{
+		ReminderId:          tools.UUIDGen(),
+		ReminderDescription: "Birthday",
+	}
+
+	err = sender.Send(context.Background(), "room 1", "Say \"hello\"", &info)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	expectedBody := `{"text":"Say \"hello\"","reminder":"Birthday"}`
+	if gotBody != expectedBody {
+		t.Errorf("Wrong body: %s", gotBody)
+	}
+
+	if (gotMethod != http.MethodPut) || (gotPath != "/hook/room 1") || (gotHeader != "application/json") {
+		t.Errorf("Wrong request: %s %s %s", gotMethod, gotPath, gotHeader)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(expectedBody))
+	if gotSignature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Wrong signature: %s", gotSignature)
+	}
+
+	config.SuccessMin = 200
+	config.SuccessMax = 200
+
+	sender, err = NewWebhookSender(config, server.Client())
+	if err != nil {
+		t.Fatalf("Unable to create sender: %v", err)
+	}
+
+	err = sender.Send(context.Background(), "room", "test", &MessageInfo{})
+	if err == nil {
+		t.Errorf("Status code outside of success range was accepted")
+	}
+}
@@ -0,0 +1,302 @@
+package sms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"notifier/tools/jwt"
+	"os"
+	"time"
+)
+
+// Parameters of the aes128gcm content encoding (RFC 8188) as used by Web Push (RFC 8291)
+const webPushRecordSize = 4096
+const webPushSaltLen = 16
+const webPushAuthSecretLen = 16
+const webPushPublicKeyLen = 65
+const webPushHeaderLen = webPushSaltLen + 4 + 1 + webPushPublicKeyLen
+const webPushTagLen = 16
+
+// The whole encrypted message consists of one record. The plaintext is followed by a delimiter octet.
+const WebPushMaxPayload = webPushRecordSize - webPushHeaderLen - webPushTagLen - 1
+
+// VAPID tokens are valid for at most 24 hours
+const vapidTokenValidity = 12 * time.Hour
+
+var ErrWebPushPayloadTooLong = errors.New("Web Push payload too long")
+
+// WebPushKeys contains the keys which are created by the browser for a push subscription
+type WebPushKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// WebPushSubscription is the JSON representation of a PushSubscription as returned by the browser. It is
+// stored as the address of a recipient of the type WebPush.
+type WebPushSubscription struct {
+	Endpoint string      `json:"endpoint"`
+	Keys     WebPushKeys `json:"keys"`
+}
+
+// decodeWebPushBase64 accepts the URL safe base64 encoding with and without padding
+func decodeWebPushBase64(s string) ([]byte, error) {
+	res, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		return res, nil
+	}
+
+	return base64.URLEncoding.DecodeString(s)
+}
+
+func ParseWebPushSubscription(address string) (*WebPushSubscription, error) {
+	var res WebPushSubscription
+
+	err := json.Unmarshal([]byte(address), &res)
+	if err != nil {
+		return nil, fmt.Errorf("push subscription is not wellformed: %v", err)
+	}
+
+	err = res.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Validate checks that the endpoint is an HTTPS URL and that the keys have the correct format
+func (w *WebPushSubscription) Validate() error {
+	endpoint, err := url.Parse(w.Endpoint)
+	if (err != nil) || (endpoint.Scheme != "https") || (endpoint.Host == "") {
+		return fmt.Errorf("push endpoint '%s' is not an HTTPS URL", w.Endpoint)
+	}
+
+	_, _, err = w.decodeKeys()
+
+	return err
+}
+
+func (w *WebPushSubscription) decodeKeys() (*ecdh.PublicKey, []byte, error) {
+	rawKey, err := decodeWebPushBase64(w.Keys.P256dh)
+	if err != nil {
+		return nil, nil, fmt.Errorf("p256dh key is not wellformed: %v", err)
+	}
+
+	uaPublic, err := ecdh.P256().NewPublicKey(rawKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("p256dh key is not wellformed: %v", err)
+	}
+
+	authSecret, err := decodeWebPushBase64(w.Keys.Auth)
+	if (err != nil) || (len(authSecret) != webPushAuthSecretLen) {
+		return nil, nil, fmt.Errorf("auth secret is not wellformed")
+	}
+
+	return uaPublic, authSecret, nil
+}
+
+// EncryptWebPush encrypts the payload for the subscription as specified in RFC 8291
+func EncryptWebPush(sub *WebPushSubscription, payload []byte) ([]byte, error) {
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, webPushSaltLen)
+
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptWebPushWithKey(sub, payload, asPrivate, salt)
+}
+
+func encryptWebPushWithKey(sub *WebPushSubscription, payload []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(payload) > WebPushMaxPayload {
+		return nil, ErrWebPushPayloadTooLong
+	}
+
+	uaPublic, authSecret, err := sub.decodeKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	prkKey, err := hkdf.Extract(sha256.New, ecdhSecret, authSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// The delimiter 0x02 marks the last (and only) record. No padding is used.
+	plaintext := append(append([]byte{}, payload...), 0x02)
+
+	res := make([]byte, 0, webPushHeaderLen+len(plaintext)+webPushTagLen)
+	res = append(res, salt...)
+	res = binary.BigEndian.AppendUint32(res, webPushRecordSize)
+	res = append(res, byte(len(asPublic)))
+	res = append(res, asPublic...)
+
+	return gcm.Seal(res, nonce, plaintext, nil), nil
+}
+
+// VapidKey is the key pair which identifies this application server towards the push services (RFC 8292)
+type VapidKey struct {
+	privateKey *ecdsa.PrivateKey
+	signer     *jwt.EsSigner
+}
+
+func NewVapidKey(pemData []byte) (*VapidKey, error) {
+	privateKey, err := jwt.LoadEcdsaPrivateKey(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load VAPID key: %v", err)
+	}
+
+	if privateKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("VAPID key has to be a P-256 key")
+	}
+
+	signer, err := jwt.NewEsSignerVerified(pemData, sha256.New, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VapidKey{
+		privateKey: privateKey,
+		signer:     signer,
+	}, nil
+}
+
+// GenerateVapidKey creates a new P-256 key and returns it as a PEM encoded PKCS#8 structure
+func GenerateVapidKey() ([]byte, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// LoadOrCreateVapidKey loads the VAPID key from the given file. If the file does not exist a
+// new key is generated and stored in it. The key must not change afterwards, because existing
+// subscriptions are bound to it.
+func LoadOrCreateVapidKey(fileName string) (*VapidKey, error) {
+	pemData, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		pemData, err = GenerateVapidKey()
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate VAPID key: %v", err)
+		}
+
+		err = os.WriteFile(fileName, pemData, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("unable to store VAPID key in '%s': %v", fileName, err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read VAPID key from '%s': %v", fileName, err)
+	}
+
+	return NewVapidKey(pemData)
+}
+
+// PublicKey returns the uncompressed public key in URL safe base64 encoding. This is the
+// applicationServerKey which the browser needs to create a subscription.
+func (v *VapidKey) PublicKey() string {
+	pub, err := v.privateKey.PublicKey.ECDH()
+	if err != nil {
+		panic(fmt.Errorf("VAPID key unusable: %v", err))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(pub.Bytes())
+}
+
+type vapidClaims struct {
+	Audience   string `json:"aud"`
+	Expiration int64  `json:"exp"`
+	Subject    string `json:"sub"`
+}
+
+// AuthHeader returns the value of the Authorization header for a request to the given push endpoint
+func (v *VapidKey) AuthHeader(endpoint string, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{"typ": jwt.TypeJwt, "alg": jwt.AlgEs256})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(&vapidClaims{
+		Audience:   u.Scheme + "://" + u.Host,
+		Expiration: now.Add(vapidTokenValidity).Unix(),
+		Subject:    subject,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	signature := v.signer.Sign([]byte(token))
+	token += "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	return fmt.Sprintf("vapid t=%s, k=%s", token, v.PublicKey()), nil
+}
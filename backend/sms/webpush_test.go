@@ -0,0 +1,206 @@
+package sms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"notifier/repo"
+	"notifier/tools"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vector from RFC 8291, appendix A
+const rfc8291Plaintext = "V2hlbiBJIGdyb3cgdXAsIEkgd2FudCB0byBiZSBhIHdhdGVybWVsb24"
+const rfc8291AsPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+const rfc8291UaPublic = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+const rfc8291UaPrivate = "q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"
+const rfc8291Salt = "DGv6ra1nlYgDCS1FRnbzlw"
+const rfc8291AuthSecret = "BTBZMqHH6r4Tts7J_aSIgg"
+const rfc8291Result = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+
+func mustDecode(t *testing.T, s string) []byte {
+	res, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("Unable to decode '%s': %v", s, err)
+	}
+
+	return res
+}
+
+func TestWebPushEncryption(t *testing.T) {
+	sub := &WebPushSubscription{
+		Endpoint: "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV",
+		Keys: WebPushKeys{
+			P256dh: rfc8291UaPublic,
+			Auth:   rfc8291AuthSecret,
+		},
+	}
+
+	asPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, rfc8291AsPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := encryptWebPushWithKey(sub, mustDecode(t, rfc8291Plaintext), asPrivate, mustDecode(t, rfc8291Salt))
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	if base64.RawURLEncoding.EncodeToString(res) != rfc8291Result {
+		t.Errorf("Wrong result: %s", base64.RawURLEncoding.EncodeToString(res))
+	}
+
+	_, err = EncryptWebPush(sub, make([]byte, WebPushMaxPayload+1))
+	if err != ErrWebPushPayloadTooLong {
+		t.Errorf("Payload length not checked")
+	}
+}
+
+// decryptWebPush is the counterpart of EncryptWebPush as performed by the browser
+func decryptWebPush(t *testing.T, uaPrivate *ecdh.PrivateKey, authSecret []byte, message []byte) []byte {
+	salt := message[:webPushSaltLen]
+	if binary.BigEndian.Uint32(message[webPushSaltLen:]) != webPushRecordSize {
+		t.Fatalf("Wrong record size")
+	}
+
+	asPublic, err := ecdh.P256().NewPublicKey(message[webPushSaltLen+5 : webPushHeaderLen])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecdhSecret, _ := uaPrivate.ECDH(asPublic)
+	prkKey, _ := hkdf.Extract(sha256.New, ecdhSecret, authSecret)
+	ikm, _ := hkdf.Expand(sha256.New, prkKey, "WebPush: info\x00"+string(uaPrivate.PublicKey().Bytes())+string(asPublic.Bytes()), 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+
+	plaintext, err := gcm.Open(nil, nonce, message[webPushHeaderLen:], nil)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+
+	if plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("Delimiter missing")
+	}
+
+	return plaintext[:len(plaintext)-1]
+}
+
+func TestWebPushSender(t *testing.T) {
+	var got webPushMessage
+	var authHeader string
+	var urgency string
+	status := http.StatusCreated
+
+	uaPrivate, err := ecdh.P256().NewPrivateKey(mustDecode(t, rfc8291UaPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		authHeader = r.Header.Get("Authorization")
+		urgency = r.Header.Get("Urgency")
+
+		if (r.Header.Get("Content-Encoding") != "aes128gcm") || (r.Header.Get("TTL") == "") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		json.Unmarshal(decryptWebPush(t, uaPrivate, mustDecode(t, rfc8291AuthSecret), body), &got)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	pemData, err := GenerateVapidKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewVapidKey(pemData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gone *tools.UUID
+	sender := NewWebPushSender(key, "mailto:admin@example.com", server.Client())
+	sender.SubscriptionGone = func(id *tools.UUID, address string) { gone = id }
+
+	address, _ := json.Marshal(&WebPushSubscription{
+		Endpoint: server.URL + "/push/abc",
+		Keys: WebPushKeys{
+			P256dh: rfc8291UaPublic,
+			Auth:   rfc8291AuthSecret,
+		},
+	})
+
+	info := MessageInfo{
+		RecipientId:         tools.UUIDGen(),
+		ReminderDescription: "Geburtstag",
+		Priority:            repo.PriorityHigh,
+	}
+
+	err = sender.Send(context.Background(), string(address), "Morgen", &info)
+	if err != nil {
+		t.Fatalf("Sending failed: %v", err)
+	}
+
+	if (got.Title != "Geburtstag") || (got.Body != "Morgen") || (urgency != "high") {
+		t.Errorf("Wrong message: %v, urgency %s", got, urgency)
+	}
+
+	if !strings.HasPrefix(authHeader, "vapid t=") || !strings.HasSuffix(authHeader, ", k="+key.PublicKey()) {
+		t.Errorf("Wrong Authorization header: %s", authHeader)
+	}
+
+	claims := vapidClaims{}
+	token := strings.Split(strings.TrimPrefix(strings.Split(authHeader, ",")[0], "vapid t="), ".")
+	json.Unmarshal(mustDecode(t, token[1]), &claims)
+
+	if (claims.Audience != server.URL) || (claims.Subject != "mailto:admin@example.com") || (claims.Expiration <= time.Now().Unix()) {
+		t.Errorf("Wrong VAPID claims: %v", claims)
+	}
+
+	status = http.StatusGone
+
+	err = sender.Send(context.Background(), string(address), "Morgen", &info)
+	if err == nil {
+		t.Fatalf("Expired subscription not detected")
+	}
+
+	if (gone == nil) || !gone.IsEqual(info.RecipientId) {
+		t.Errorf("Expired subscription not reported")
+	}
+
+	// The message was redirected to a substitute which owns the subscription
+	info.ChannelOwnerId = tools.UUIDGen()
+
+	err = sender.Send(context.Background(), string(address), "Morgen", &info)
+	if err == nil {
+		t.Fatalf("Expired subscription not detected")
+	}
+
+	if (gone == nil) || !gone.IsEqual(info.ChannelOwnerId) {
+		t.Errorf("Expired subscription not reported for owner of channel")
+	}
+
+	_, err = ParseWebPushSubscription(`{"endpoint":"http://push.example.net","keys":{"p256dh":"` + rfc8291UaPublic + `","auth":"` + rfc8291AuthSecret + `"}}`)
+	if err == nil {
+		t.Errorf("Plain HTTP endpoint accepted")
+	}
+}
@@ -0,0 +1,172 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"notifier/repo"
+	"notifier/tools"
+	"os"
+	"strconv"
+	"time"
+)
+
+const envWebPushKeyFile = "MN_WEBPUSH_KEY_FILE"
+const envWebPushSubject = "MN_WEBPUSH_SUBJECT"
+
+// Push services store a message for this amount of time if the browser is not reachable
+const webPushTtl = 24 * time.Hour
+
+const webPushDefaultTitle = "Mobile notifier"
+
+var webPushUrgencies = map[repo.Priority]string{
+	repo.PriorityLow:    "low",
+	repo.PriorityNormal: "normal",
+	repo.PriorityHigh:   "high",
+	repo.PriorityUrgent: "high",
+}
+
+// ErrWebPushSubscriptionGone is returned when the push service reports that a subscription has
+// expired or has been revoked by the user
+var ErrWebPushSubscriptionGone = errors.New("push subscription no longer valid")
+
+// webPushMessage is the payload which is received by the service worker of the web frontend
+type webPushMessage struct {
+	Title          string      `json:"title"`
+	Body           string      `json:"body"`
+	NotificationId *tools.UUID `json:"notification_id,omitempty"`
+	ReminderId     *tools.UUID `json:"reminder_id,omitempty"`
+}
+
+// WebPushSender sends messages to browsers via the Web Push protocol. The address of a recipient is
+// the push subscription of the browser in its JSON representation. When the push service reports
+// that a subscription is gone, SubscriptionGone is called with the id of the recipient which owns the
+// subscription and the subscription which is no longer valid.
+type WebPushSender struct {
+	Key              *VapidKey
+	Subject          string
+	Ttl              time.Duration
+	Client           *http.Client
+	SubscriptionGone func(recipientId *tools.UUID, address string)
+}
+
+func NewWebPushSender(key *VapidKey, subject string, c *http.Client) *WebPushSender {
+	return &WebPushSender{
+		Key:              key,
+		Subject:          subject,
+		Ttl:              webPushTtl,
+		Client:           c,
+		SubscriptionGone: func(*tools.UUID, string) {},
+	}
+}
+
+func NewWebPushSenderFromEnvironment() (*WebPushSender, error) {
+	keyFile, ok := os.LookupEnv(envWebPushKeyFile)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envWebPushKeyFile)
+	}
+
+	subject, ok := os.LookupEnv(envWebPushSubject)
+	if !ok {
+		return nil, fmt.Errorf("Environment variable %s not set", envWebPushSubject)
+	}
+
+	key, err := LoadOrCreateVapidKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := tools.MakeCustomHttpClient()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to create custom HTTP client object: %v", err)
+	}
+
+	return NewWebPushSender(key, subject, client), nil
+}
+
+func (w *WebPushSender) GetName() string {
+	return TypeWebPush
+}
+
+func (w *WebPushSender) Send(ctx context.Context, recipientAddress string, message string, info *MessageInfo) error {
+	sub, err := ParseWebPushSubscription(recipientAddress)
+	if err != nil {
+		return err
+	}
+
+	msg := webPushMessage{
+		Title:          webPushDefaultTitle,
+		Body:           message,
+		NotificationId: info.NotificationId,
+		ReminderId:     info.ReminderId,
+	}
+
+	if info.ReminderDescription != "" {
+		msg.Title = info.ReminderDescription
+	}
+
+	payload, err := json.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := EncryptWebPush(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	auth, err := w.Key.AuthHeader(sub.Endpoint, w.Subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(encrypted))
+	if err != nil {
+		return err
+	}
+
+	urgency, ok := webPushUrgencies[info.Priority]
+	if !ok {
+		urgency = webPushUrgencies[repo.PriorityNormal]
+	}
+
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.FormatInt(int64(w.Ttl/time.Second), 10))
+	req.Header.Set("Urgency", urgency)
+
+	res, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { res.Body.Close() }()
+
+	// Ignore body
+	_, _ = io.ReadAll(res.Body)
+
+	if (res.StatusCode == http.StatusNotFound) || (res.StatusCode == http.StatusGone) {
+		// The subscription belongs to the owner of the channel, which is not the original recipient if
+		// the message was redirected
+		owner := info.ChannelOwnerId
+		if owner == nil {
+			owner = info.RecipientId
+		}
+
+		if owner != nil {
+			w.SubscriptionGone(owner, recipientAddress)
+		}
+
+		return fmt.Errorf("%w: server responded with error code %d", ErrWebPushSubscriptionGone, res.StatusCode)
+	}
+
+	if (res.StatusCode < 200) || (res.StatusCode >= 300) {
+		return fmt.Errorf("server responded with error code %d", res.StatusCode)
+	}
+
+	return nil
+}
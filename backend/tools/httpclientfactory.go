@@ -10,10 +10,13 @@ import (
 
 const EnvAdditionalRootCerts = "MN_ADDITIONAL_ROOTS"
 
-func MakeCustomHttpClient() (*http.Client, error) {
+// MakeCustomTlsConfig returns a TLS config which trusts the system roots and the additional roots
+// referenced by MN_ADDITIONAL_ROOTS. If this variable is not set nil is returned, i.e. the default
+// config is to be used.
+func MakeCustomTlsConfig() (*tls.Config, error) {
 	rootFilename, ok := os.LookupEnv(EnvAdditionalRootCerts)
 	if !ok {
-		return http.DefaultClient, nil
+		return nil, nil
 	}
 
 	rootCAs, _ := x509.SystemCertPool()
@@ -35,6 +38,19 @@ func MakeCustomHttpClient() (*http.Client, error) {
 		RootCAs: rootCAs,
 	}
 
+	return tlsConfig, nil
+}
+
+func MakeCustomHttpClient() (*http.Client, error) {
+	tlsConfig, err := MakeCustomTlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if tlsConfig == nil {
+		return http.DefaultClient, nil
+	}
+
 	tr := &http.Transport{
 		TLSClientConfig: tlsConfig,
 	}
@@ -6,10 +6,13 @@ const NotificationSent = "notification_count"
 const CommandSendMetrics = "CMD_SEND"
 
 type AddMetricsEvent func(string)
+type SetMetricsValue func(string, int)
 
 type MetricsInstruction struct {
 	Command         string
 	ResponseChannel chan map[string]int
+	IsValue         bool
+	Value           int
 }
 
 type MetricsCollector struct {
@@ -30,6 +33,11 @@ func NewMetricsCollector() *MetricsCollector {
 
 func (m *MetricsCollector) eventLoop() {
 	for val := range m.receiverChannel {
+		if val.IsValue {
+			m.metrics[val.Command] = val.Value
+			continue
+		}
+
 		switch val.Command {
 		case CommandSendMetrics:
 			res := maps.Clone(m.metrics)
@@ -86,3 +94,15 @@ func (m *MetricsCollector) AddEvent(eventID string) {
 
 	go sendFunc(eventID)
 }
+
+// SetValue sets the metric identified by name to the given value. In contrast to AddEvent this
+// does not count occurrences but stores the current state of something, e.g. the length of a queue.
+// The value is handed over synchronously in order to make sure that the last value set always wins.
+func (m *MetricsCollector) SetValue(name string, value int) {
+	m.receiverChannel <- MetricsInstruction{
+		Command:         name,
+		ResponseChannel: nil,
+		IsValue:         true,
+		Value:           value,
+	}
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 const VersionString = "1.5.5"
@@ -38,3 +39,29 @@ func GenerateNotificationTextJson(prefix string, hour int, minute int, descripti
 
 	return string(data)
 }
+
+// ParseKeyValueList parses strings of the form "key1=value1,key2=value2" into a map. Whitespace
+// around keys and values is ignored.
+func ParseKeyValueList(spec string) (map[string]string, error) {
+	res := map[string]string{}
+
+	for _, j := range strings.Split(spec, ",") {
+		if strings.TrimSpace(j) == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(j, "=")
+		if !found {
+			return nil, fmt.Errorf("entry '%s' is not of the form key=value", j)
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("entry '%s' has an empty key", j)
+		}
+
+		res[key] = strings.TrimSpace(value)
+	}
+
+	return res, nil
+}